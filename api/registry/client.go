@@ -6,7 +6,7 @@ import (
 	"buf.build/gen/go/namespace/cloud/grpc/go/proto/namespace/cloud/registry/v1beta/registryv1betagrpc"
 	"google.golang.org/grpc"
 	"namespacelabs.dev/integrations/api"
-	"namespacelabs.dev/integrations/nsc/apienv"
+	"namespacelabs.dev/integrations/nsc/endpoints"
 	"namespacelabs.dev/integrations/nsc/grpcapi"
 )
 
@@ -16,20 +16,30 @@ type Client struct {
 	Conn *grpc.ClientConn
 }
 
+// NewClient connects to the endpoint set with grpcapi.WithEndpoint or, by
+// default, to the global endpoint. It accepts the options described in
+// grpcapi.Options.
 func NewClient(ctx context.Context, token api.TokenSource, opts ...grpc.DialOption) (Client, error) {
-	return NewClientWithEndpoint(ctx, apienv.GlobalEndpoint(), token, opts...)
-}
-
-func NewClientWithEndpoint(ctx context.Context, endpoint string, token api.TokenSource, opts ...grpc.DialOption) (Client, error) {
-	conn, err := grpcapi.NewConnectionWithEndpoint(ctx, endpoint, token, opts...)
+	conn, _, err := grpcapi.NewConnection(ctx, token, func() (string, error) {
+		return endpoints.Endpoint(ctx, endpoints.Global, token)
+	}, opts...)
 	if err != nil {
 		return Client{}, err
 	}
 
+	return NewClientFromConn(conn), nil
+}
+
+func NewClientWithEndpoint(ctx context.Context, endpoint string, token api.TokenSource, opts ...grpc.DialOption) (Client, error) {
+	return NewClient(ctx, token, append(opts[:len(opts):len(opts)], grpcapi.WithEndpoint(endpoint))...)
+}
+
+// NewClientFromConn returns a client which uses conn, which it closes on Close.
+func NewClientFromConn(conn *grpc.ClientConn) Client {
 	return Client{
 		ContainerRegistry: registryv1betagrpc.NewContainerRegistryServiceClient(conn),
 		Conn:              conn,
-	}, nil
+	}
 }
 
 func (c Client) Close() error {
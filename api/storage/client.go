@@ -23,7 +23,9 @@ import (
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
 	"namespacelabs.dev/integrations/api"
+	"namespacelabs.dev/integrations/nsc/endpoints"
 	"namespacelabs.dev/integrations/nsc/grpcapi"
+	"namespacelabs.dev/integrations/nsc/telemetry"
 )
 
 const (
@@ -42,32 +44,51 @@ type Client struct {
 	Artifacts storagev1betagrpc.ArtifactsServiceClient
 
 	Conn *grpc.ClientConn
+	// Used to upload and download artifacts. Defaults to telemetry.HTTPClient.
+	HTTPClient *http.Client
 }
 
+// NewClient connects to the endpoint set with grpcapi.WithEndpoint or, by
+// default, to the tenant's regional endpoint (see nsc/endpoints), which is
+// resolved by issuing a token. It accepts the options described in
+// grpcapi.Options.
 func NewClient(ctx context.Context, token api.TokenSource, opts ...grpc.DialOption) (Client, error) {
-	if endpoint := os.Getenv("NSC_STORAGE_ENDPOINT"); endpoint != "" {
-		return NewClientWithEndpoint(ctx, endpoint, token, opts...)
+	conn, o, err := grpcapi.NewConnection(ctx, token, func() (string, error) {
+		return endpoints.Endpoint(ctx, endpoints.Storage, token)
+	}, opts...)
+	if err != nil {
+		return Client{}, err
 	}
 
-	return NewClientWithEndpoint(ctx, "https://ord.storage.namespaceapis.com", token, opts...)
+	c := NewClientFromConn(conn)
+	c.HTTPClient = o.HTTPClient
+	return c, nil
 }
 
 func NewClientWithEndpoint(ctx context.Context, endpoint string, token api.TokenSource, opts ...grpc.DialOption) (Client, error) {
-	conn, err := grpcapi.NewConnectionWithEndpoint(ctx, endpoint, token, opts...)
-	if err != nil {
-		return Client{}, err
-	}
+	return NewClient(ctx, token, append(opts[:len(opts):len(opts)], grpcapi.WithEndpoint(endpoint))...)
+}
 
+// NewClientFromConn returns a client which uses conn, which it closes on Close.
+func NewClientFromConn(conn *grpc.ClientConn) Client {
 	return Client{
 		Artifacts: storagev1betagrpc.NewArtifactsServiceClient(conn),
 		Conn:      conn,
-	}, nil
+	}
 }
 
 func (c Client) Close() error {
 	return c.Conn.Close()
 }
 
+func (c Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+
+	return telemetry.HTTPClient
+}
+
 func UploadArtifact(ctx context.Context, c Client, namespace, path string, in io.Reader) error {
 	_, err := UploadArtifactWithOpts(ctx, c, namespace, path, in, UploadOpts{})
 	return err
@@ -159,7 +180,7 @@ func UploadArtifactWithOpts(ctx context.Context, c Client, namespace, path strin
 		httpReq.Header.Set("Content-MD5", o.MD5)
 	}
 
-	httpRes, err := http.DefaultClient.Do(httpReq)
+	httpRes, err := c.httpClient().Do(httpReq)
 	if err != nil {
 		return ArtifactInfo{}, fmt.Errorf("failed to upload file: %w", err)
 	}
@@ -217,7 +238,7 @@ func ResolveArtifactWithOpts(ctx context.Context, cli Client, namespace, path st
 		return nil, ArtifactInfo{}, fmt.Errorf("failed to construct http request: %w", err)
 	}
 
-	httpRes, err := http.DefaultClient.Do(httpReq)
+	httpRes, err := cli.httpClient().Do(httpReq)
 	if err != nil {
 		return nil, ArtifactInfo{}, fmt.Errorf("failed to download file: %w", err)
 	}
@@ -317,7 +338,7 @@ func CacheURL(ctx context.Context, cli Client, sourceURL string, opts CacheURLOp
 		return nil, CacheInfo{}, fmt.Errorf("failed to prepare request: %w", err)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := cli.httpClient().Do(req)
 	if err != nil {
 		return nil, CacheInfo{}, CacheSourceError{fmt.Errorf("failed to send request: %w", err), 0}
 	}
@@ -2,11 +2,11 @@ package vault
 
 import (
 	"context"
-	"os"
 
 	"buf.build/gen/go/namespace/cloud/grpc/go/proto/namespace/cloud/vault/v1beta/vaultv1betagrpc"
 	"google.golang.org/grpc"
 	"namespacelabs.dev/integrations/api"
+	"namespacelabs.dev/integrations/nsc/endpoints"
 	"namespacelabs.dev/integrations/nsc/grpcapi"
 )
 
@@ -16,24 +16,31 @@ type Client struct {
 	Conn *grpc.ClientConn
 }
 
+// NewClient connects to the endpoint set with grpcapi.WithEndpoint or, by
+// default, to the tenant's regional endpoint (see nsc/endpoints), which is
+// resolved by issuing a token. It accepts the options described in
+// grpcapi.Options.
 func NewClient(ctx context.Context, token api.TokenSource, opts ...grpc.DialOption) (Client, error) {
-	if endpoint := os.Getenv("NSC_ENDPOINT"); endpoint != "" {
-		return NewClientWithEndpoint(ctx, endpoint, token)
+	conn, _, err := grpcapi.NewConnection(ctx, token, func() (string, error) {
+		return endpoints.Endpoint(ctx, endpoints.Compute, token)
+	}, opts...)
+	if err != nil {
+		return Client{}, err
 	}
 
-	return NewClientWithEndpoint(ctx, "https://us.compute.namespaceapis.com", token, opts...)
+	return NewClientFromConn(conn), nil
 }
 
 func NewClientWithEndpoint(ctx context.Context, endpoint string, token api.TokenSource, opts ...grpc.DialOption) (Client, error) {
-	conn, err := grpcapi.NewConnectionWithEndpoint(ctx, endpoint, token, opts...)
-	if err != nil {
-		return Client{}, err
-	}
+	return NewClient(ctx, token, append(opts[:len(opts):len(opts)], grpcapi.WithEndpoint(endpoint))...)
+}
 
+// NewClientFromConn returns a client which uses conn, which it closes on Close.
+func NewClientFromConn(conn *grpc.ClientConn) Client {
 	return Client{
 		Vault: vaultv1betagrpc.NewVaultServiceClient(conn),
 		Conn:  conn,
-	}, nil
+	}
 }
 
 func (c Client) Close() error {
@@ -0,0 +1,291 @@
+package authtest
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"buf.build/gen/go/namespace/cloud/grpc/go/proto/namespace/cloud/iam/v1beta/iamv1betagrpc"
+	iamv1beta "buf.build/gen/go/namespace/cloud/protocolbuffers/go/proto/namespace/cloud/iam/v1beta"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"namespacelabs.dev/integrations/api"
+	"namespacelabs.dev/integrations/api/iam"
+	"namespacelabs.dev/integrations/auth"
+)
+
+const defaultIssueDuration = time.Hour
+
+// IAMServer is an in-process fake of the IAM tenant and token services. It
+// serves over TLS on a loopback address, issues tokens signed by its Signer,
+// and client certificates from a local CA. Certificates name the tenant as
+// their common name and the actor as their organizational unit, as nstls
+// expects.
+//
+// gRPC calls must carry a bearer token, but any token is accepted. The JSON
+// methods used by federation are served by ServeHTTP.
+type IAMServer struct {
+	iamv1betagrpc.UnimplementedTenantServiceServer
+
+	Signer *Signer
+
+	caCert *x509.Certificate
+	caKey  crypto.Signer
+
+	lis net.Listener
+	srv *grpc.Server
+
+	mu         sync.Mutex
+	tenants    map[string]*iamv1beta.Tenant // By external account ID.
+	calls      map[string]int
+	oidcTokens []string
+	revokable  map[string]*iamv1beta.RevokableToken // By token ID.
+}
+
+// NewIAMServer starts a fake IAM server. Close it when done.
+func NewIAMServer() (*IAMServer, error) {
+	s := &IAMServer{
+		Signer:    NewSigner(),
+		tenants:   map[string]*iamv1beta.Tenant{},
+		calls:     map[string]int{},
+		revokable: map[string]*iamv1beta.RevokableToken{},
+	}
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "authtest CA"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.caCert, err = x509.ParseCertificate(caDER); err != nil {
+		return nil, err
+	}
+
+	s.caKey = caKey
+
+	serverKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serverDER, err := s.sign(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "localhost"},
+		DNSNames:    []string{"localhost"},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, &serverKey.PublicKey, 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lis, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s.srv = grpc.NewServer(
+		grpc.Creds(credentials.NewServerTLSFromCert(&tls.Certificate{
+			Certificate: [][]byte{serverDER},
+			PrivateKey:  serverKey,
+		})),
+		grpc.UnaryInterceptor(s.intercept))
+
+	iamv1betagrpc.RegisterTenantServiceServer(s.srv, s)
+	iamv1betagrpc.RegisterTokenServiceServer(s.srv, tokenService{s: s})
+
+	go func() { _ = s.srv.Serve(s.lis) }()
+
+	return s, nil
+}
+
+// Endpoint returns the address the server listens on.
+func (s *IAMServer) Endpoint() string {
+	return s.lis.Addr().String()
+}
+
+// CertPool returns a pool with the CA which issues the server's and client
+// certificates.
+func (s *IAMServer) CertPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(s.caCert)
+	return pool
+}
+
+// DialOptions returns the options to connect to the server, for use with
+// iam.NewClientWithEndpoint and friends.
+func (s *IAMServer) DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{RootCAs: s.CertPool()})),
+	}
+}
+
+// Client returns an IAM client connected to the server, authenticated with token.
+func (s *IAMServer) Client(ctx context.Context, token api.TokenSource) (iam.Client, error) {
+	return iam.NewClientWithEndpoint(ctx, s.Endpoint(), token, s.DialOptions()...)
+}
+
+// Calls returns how many times method (e.g. "IssueTenantToken") was called.
+func (s *IAMServer) Calls(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[method]
+}
+
+func (s *IAMServer) Close() {
+	s.srv.Stop()
+}
+
+func (s *IAMServer) intercept(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	s.mu.Lock()
+	s.calls[info.FullMethod[strings.LastIndexByte(info.FullMethod, '/')+1:]]++
+	s.mu.Unlock()
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	if auth := md.Get("authorization"); len(auth) == 0 || !strings.HasPrefix(auth[0], "Bearer ") {
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+
+	return handler(ctx, req)
+}
+
+func (s *IAMServer) EnsureTenantForExternalAccount(_ context.Context, req *iamv1beta.EnsureTenantForExternalAccountRequest) (*iamv1beta.TenantResponse, error) {
+	if req.ExternalAccountId == "" {
+		return nil, status.Error(codes.InvalidArgument, "external_account_id is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenant, ok := s.tenants[req.ExternalAccountId]
+	if !ok {
+		tenant = &iamv1beta.Tenant{
+			Id:                fmt.Sprintf("tenant_%d", len(s.tenants)+1),
+			ExternalAccountId: req.ExternalAccountId,
+			CreatedAt:         timestamppb.Now(),
+		}
+
+		s.tenants[req.ExternalAccountId] = tenant
+	}
+
+	tenant.VisibleName = req.VisibleName
+	tenant.Labels = req.Labels
+
+	return &iamv1beta.TenantResponse{Tenant: tenant}, nil
+}
+
+func (s *IAMServer) IssueTenantToken(_ context.Context, req *iamv1beta.IssueTenantTokenRequest) (*iamv1beta.IssueTenantTokenResponse, error) {
+	if req.TenantId == "" {
+		return nil, status.Error(codes.InvalidArgument, "tenant_id is required")
+	}
+
+	token := s.Signer.MintToken(auth.TokenKindTenant, auth.TokenClaims{
+		TenantID: req.TenantId,
+		ActorID:  req.ActorId,
+	}, time.Now().Add(issueDuration(req.DurationSecs)))
+
+	return &iamv1beta.IssueTenantTokenResponse{BearerToken: token}, nil
+}
+
+func (s *IAMServer) IssueTenantClientCertificate(_ context.Context, req *iamv1beta.IssueTenantClientCertificateRequest) (*iamv1beta.IssueTenantClientCertificateResponse, error) {
+	if req.TenantId == "" {
+		return nil, status.Error(codes.InvalidArgument, "tenant_id is required")
+	}
+
+	resp := &iamv1beta.IssueTenantClientCertificateResponse{}
+
+	var pub crypto.PublicKey
+	if req.PublicKeyPem != "" {
+		block, _ := pem.Decode([]byte(req.PublicKeyPem))
+		if block == nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid public key")
+		}
+
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid public key: %v", err)
+		}
+
+		pub = parsed
+	} else {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+
+		pub = &key.PublicKey
+		resp.PrivateKeyPem = string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+	}
+
+	subject := pkix.Name{CommonName: req.TenantId}
+	if req.ActorId != "" {
+		subject.OrganizationalUnit = []string{req.ActorId}
+	}
+
+	der, err := s.sign(&x509.Certificate{
+		Subject:     subject,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, pub, issueDuration(req.DurationSecs))
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	resp.ClientCertificatePem = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	return resp, nil
+}
+
+func (s *IAMServer) sign(template *x509.Certificate, pub crypto.PublicKey, dur time.Duration) ([]byte, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+
+	template.SerialNumber = serial
+	template.NotBefore = time.Now().Add(-time.Minute)
+	template.NotAfter = time.Now().Add(dur)
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+
+	return x509.CreateCertificate(rand.Reader, template, s.caCert, pub, s.caKey)
+}
+
+func issueDuration(secs int64) time.Duration {
+	if secs <= 0 {
+		return defaultIssueDuration
+	}
+
+	return time.Duration(secs) * time.Second
+}
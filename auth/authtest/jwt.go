@@ -0,0 +1,99 @@
+package authtest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"namespacelabs.dev/integrations/auth"
+)
+
+var tokenPrefixes = map[auth.TokenKind]string{
+	auth.TokenKindSession:  "st_",
+	auth.TokenKindTenant:   "nsct_",
+	auth.TokenKindWorkload: "nscw_",
+}
+
+// Signer mints Namespace tokens signed with an Ed25519 key, which an
+// auth.Verifier accepts when pointed at the Signer's key set.
+type Signer struct {
+	KeyID  string
+	Issuer string
+
+	key ed25519.PrivateKey
+}
+
+func NewSigner() *Signer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	return &Signer{KeyID: "authtest", Issuer: "authtest", key: key}
+}
+
+// MintToken returns a token of the given kind carrying claims. If expiry is not
+// zero, it overrides the claims' expiry. Panics if kind does not carry claims.
+func (s *Signer) MintToken(kind auth.TokenKind, claims auth.TokenClaims, expiry time.Time) string {
+	prefix, ok := tokenPrefixes[kind]
+	if !ok {
+		panic(fmt.Sprintf("can't mint %v tokens", kind))
+	}
+
+	if claims.Issuer == "" {
+		claims.Issuer = s.Issuer
+	}
+
+	if claims.IssuedAt == nil {
+		claims.IssuedAt = jwt.NewNumericDate(time.Now())
+	}
+
+	if !expiry.IsZero() {
+		claims.ExpiresAt = jwt.NewNumericDate(expiry)
+	}
+
+	t := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	t.Header["kid"] = s.KeyID
+
+	signed, err := t.SignedString(s.key)
+	if err != nil {
+		panic(err)
+	}
+
+	return prefix + signed
+}
+
+// JWKS returns the JSON Web Key Set with the Signer's public key.
+func (s *Signer) JWKS() []byte {
+	jwks, err := json.Marshal(map[string]any{
+		"keys": []map[string]string{{
+			"kid": s.KeyID,
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"use": "sig",
+			"x":   base64.RawURLEncoding.EncodeToString(s.key.Public().(ed25519.PublicKey)),
+		}},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	return jwks
+}
+
+// ServeHTTP serves the Signer's key set, e.g. as the JWKSURL of an auth.Verifier.
+func (s *Signer) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(s.JWKS())
+}
+
+// MintToken returns a token of the given kind, with claims, signed by a
+// throwaway key. Use a Signer for tokens which need to verify.
+func MintToken(kind auth.TokenKind, claims auth.TokenClaims) string {
+	return NewSigner().MintToken(kind, claims, time.Time{})
+}
@@ -0,0 +1,84 @@
+package authtest
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"buf.build/gen/go/namespace/cloud/grpc/go/proto/namespace/cloud/iam/v1beta/iamv1betagrpc"
+	iamv1beta "buf.build/gen/go/namespace/cloud/protocolbuffers/go/proto/namespace/cloud/iam/v1beta"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"namespacelabs.dev/integrations/auth"
+)
+
+// tokenService serves the IAM token service, issuing revokable tokens as
+// tenant tokens of a fixed tenant.
+type tokenService struct {
+	iamv1betagrpc.UnimplementedTokenServiceServer
+
+	s *IAMServer
+}
+
+// RevokableTenantID is the tenant that revokable tokens are issued for.
+const RevokableTenantID = "tenant_revokable"
+
+func (t tokenService) IssueTenantToken(ctx context.Context, req *iamv1beta.IssueTenantTokenRequest) (*iamv1beta.IssueTenantTokenResponse, error) {
+	return t.s.IssueTenantToken(ctx, req)
+}
+
+func (t tokenService) CreateRevokableToken(_ context.Context, req *iamv1beta.CreateRevokableTokenRequest) (*iamv1beta.CreateRevokableTokenResponse, error) {
+	if req.Name == "" || req.ExpiresAt == nil {
+		return nil, status.Error(codes.InvalidArgument, "name and expires_at are required")
+	}
+
+	t.s.mu.Lock()
+	defer t.s.mu.Unlock()
+
+	token := &iamv1beta.RevokableToken{
+		TokenId:     fmt.Sprintf("tok_%d", len(t.s.revokable)+1),
+		TenantId:    RevokableTenantID,
+		Name:        req.Name,
+		Description: req.Description,
+		CreatedAt:   timestamppb.Now(),
+		ExpiresAt:   req.ExpiresAt,
+		Permissions: req.GetAccess().GetGrants(),
+		State:       iamv1beta.RevokableToken_ACTIVE,
+	}
+
+	t.s.revokable[token.TokenId] = token
+
+	bearer := t.s.Signer.MintToken(auth.TokenKindTenant, auth.TokenClaims{TenantID: RevokableTenantID}, req.ExpiresAt.AsTime())
+	return &iamv1beta.CreateRevokableTokenResponse{BearerToken: bearer, Token: proto.Clone(token).(*iamv1beta.RevokableToken)}, nil
+}
+
+func (t tokenService) RevokeRevokableToken(_ context.Context, req *iamv1beta.RevokeRevokableTokenRequest) (*emptypb.Empty, error) {
+	t.s.mu.Lock()
+	defer t.s.mu.Unlock()
+
+	token, ok := t.s.revokable[req.TokenId]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no token %q", req.TokenId)
+	}
+
+	token.State = iamv1beta.RevokableToken_REVOKED
+	token.RevokedAt = timestamppb.New(time.Now())
+	return &emptypb.Empty{}, nil
+}
+
+// RevokableToken returns the revokable token with id, as IAM would list it,
+// or nil if there's no such token.
+func (s *IAMServer) RevokableToken(id string) *iamv1beta.RevokableToken {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.revokable[id]
+	if !ok {
+		return nil
+	}
+
+	return proto.Clone(token).(*iamv1beta.RevokableToken)
+}
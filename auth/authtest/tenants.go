@@ -0,0 +1,62 @@
+package authtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"namespacelabs.dev/integrations/auth"
+)
+
+const exchangeOIDCTokenPath = "/nsl.tenants.TenantsService/ExchangeOIDCToken"
+
+// ServeHTTP serves the JSON methods of the tenants service which federation
+// uses; serve it with httptest.NewServer and use the server's URL as the IAM
+// endpoint. Only ExchangeOIDCToken is served; any OIDC token is accepted, and
+// exchanged for an hour-long token of the requested tenant.
+func (s *IAMServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != exchangeOIDCTokenPath {
+		http.NotFound(w, r)
+		return
+	}
+
+	var req struct {
+		TenantID  string `json:"tenant_id"`
+		OIDCToken string `json:"oidc_token"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeStatus(w, codes.InvalidArgument, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	s.calls["ExchangeOIDCToken"]++
+	s.oidcTokens = append(s.oidcTokens, req.OIDCToken)
+	s.mu.Unlock()
+
+	if req.TenantID == "" || req.OIDCToken == "" {
+		writeStatus(w, codes.InvalidArgument, "tenant_id and oidc_token are required")
+		return
+	}
+
+	token := s.Signer.MintToken(auth.TokenKindTenant, auth.TokenClaims{TenantID: req.TenantID}, time.Now().Add(defaultIssueDuration))
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"tenant_token": token})
+}
+
+// OIDCTokens returns the OIDC tokens which were exchanged, in order.
+func (s *IAMServer) OIDCTokens() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.oidcTokens...)
+}
+
+func writeStatus(w http.ResponseWriter, code codes.Code, msg string) {
+	w.Header().Set("grpc-status", strconv.Itoa(int(code)))
+	w.Header().Set("grpc-message", msg)
+	w.WriteHeader(http.StatusBadRequest)
+}
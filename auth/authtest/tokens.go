@@ -0,0 +1,74 @@
+// Package authtest provides credentials and a fake IAM service for tests of
+// code that uses Namespace APIs.
+package authtest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"namespacelabs.dev/integrations/api"
+	"namespacelabs.dev/integrations/auth"
+)
+
+// StaticTokenSource always returns token, regardless of the requested
+// duration.
+func StaticTokenSource(token string) api.TokenSource {
+	return staticToken(token)
+}
+
+type staticToken string
+
+func (t staticToken) IssueToken(context.Context, time.Duration, bool) (string, error) {
+	return string(t), nil
+}
+
+// ExpiringTokenSource mints tenant tokens which expire after Lifetime, and
+// mints a new one whenever the current one does not last the requested
+// duration, or a refresh is forced. It counts how many tokens it has minted.
+type ExpiringTokenSource struct {
+	Signer   *Signer
+	Claims   auth.TokenClaims
+	Lifetime time.Duration
+
+	mu      sync.Mutex
+	current string
+	expiry  time.Time
+	issued  int
+}
+
+// NewExpiringTokenSource returns a source of tenant tokens for tenantID,
+// signed by signer.
+func NewExpiringTokenSource(signer *Signer, tenantID string, lifetime time.Duration) *ExpiringTokenSource {
+	return &ExpiringTokenSource{
+		Signer:   signer,
+		Claims:   auth.TokenClaims{TenantID: tenantID},
+		Lifetime: lifetime,
+	}
+}
+
+func (ts *ExpiringTokenSource) IssueToken(_ context.Context, minDuration time.Duration, force bool) (string, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if minDuration > ts.Lifetime {
+		return "", fmt.Errorf("tokens are only valid for %v, %v were requested", ts.Lifetime, minDuration)
+	}
+
+	if !force && ts.current != "" && time.Now().Add(minDuration).Before(ts.expiry) {
+		return ts.current, nil
+	}
+
+	ts.expiry = time.Now().Add(ts.Lifetime)
+	ts.current = ts.Signer.MintToken(auth.TokenKindTenant, ts.Claims, ts.expiry)
+	ts.issued++
+	return ts.current, nil
+}
+
+// Issued returns the number of tokens minted so far.
+func (ts *ExpiringTokenSource) Issued() int {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.issued
+}
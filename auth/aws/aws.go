@@ -6,11 +6,30 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/ratelimit"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/cognitoidentity"
 	"namespacelabs.dev/integrations/api"
+	"namespacelabs.dev/integrations/auth"
 )
 
+const (
+	// Cognito's default OpenID token duration.
+	defaultTokenDuration = 15 * time.Minute
+	defaultMaxAttempts   = 5
+)
+
+type FederationOpts struct {
+	// Duration of the OpenID tokens requested from Cognito; longer durations
+	// are requested if a caller requires them. Defaults to 15 minutes.
+	TokenDuration time.Duration
+
+	// Maximum number of attempts when Cognito throttles requests, or fails
+	// with a retryable error. Defaults to 5.
+	MaxAttempts int
+}
+
 func Federation(ctx context.Context, identityPool, namespacePartnerId string) (api.TokenSource, error) {
 	cfg, err := config.LoadDefaultConfig(ctx)
 	if err != nil {
@@ -21,7 +40,32 @@ func Federation(ctx context.Context, identityPool, namespacePartnerId string) (a
 }
 
 func FederationFromConfig(config aws.Config, identityPool, namespacePartnerId string) api.TokenSource {
-	return cognitoTokens{cognitoidentity.NewFromConfig(config), identityPool, namespacePartnerId}
+	return FederationWithOpts(config, identityPool, namespacePartnerId, FederationOpts{})
+}
+
+// FederationWithOpts returns a TokenSource backed by Cognito developer
+// identities. OpenID tokens are cached until near their expiry, and throttled
+// requests are retried with exponential backoff.
+func FederationWithOpts(config aws.Config, identityPool, namespacePartnerId string, opts FederationOpts) api.TokenSource {
+	if opts.TokenDuration <= 0 {
+		opts.TokenDuration = defaultTokenDuration
+	}
+
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaultMaxAttempts
+	}
+
+	client := cognitoidentity.NewFromConfig(config, func(o *cognitoidentity.Options) {
+		o.Retryer = retry.NewStandard(func(so *retry.StandardOptions) {
+			so.MaxAttempts = opts.MaxAttempts
+			// Throttling is expected under load; don't give up on retries
+			// because a client-side retry quota was exhausted.
+			so.RateLimiter = ratelimit.None
+		})
+	})
+
+	c := cognitoTokens{client, identityPool, namespacePartnerId}
+	return auth.CachedTokenSource(c.issue, auth.CacheOpts{Duration: opts.TokenDuration})
 }
 
 type cognitoTokens struct {
@@ -30,18 +74,20 @@ type cognitoTokens struct {
 	namespacePartnerId string
 }
 
-func (c cognitoTokens) IssueToken(ctx context.Context, minDuration time.Duration, force bool) (string, error) {
+func (c cognitoTokens) issue(ctx context.Context, dur time.Duration) (string, time.Time, error) {
 	params := &cognitoidentity.GetOpenIdTokenForDeveloperIdentityInput{
 		IdentityPoolId: aws.String(c.identityPool),
 		Logins: map[string]string{
 			"namespace.so": c.namespacePartnerId,
 		},
+		TokenDuration: aws.Int64(int64(dur.Seconds())),
 	}
 
+	issuedAt := time.Now()
 	resp, err := c.client.GetOpenIdTokenForDeveloperIdentity(ctx, params)
 	if err != nil {
-		return "", fmt.Errorf("failed to get Cognito token: %w", err)
+		return "", time.Time{}, fmt.Errorf("failed to get Cognito token: %w", err)
 	}
 
-	return "cognito_" + *resp.Token, nil
+	return "cognito_" + *resp.Token, issuedAt.Add(dur), nil
 }
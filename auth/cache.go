@@ -0,0 +1,269 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"namespacelabs.dev/integrations/api"
+)
+
+const (
+	// Defaults for cached tokens and certificates.
+	defaultCachedDuration = time.Hour
+	defaultRefreshAhead   = 5 * time.Minute
+
+	// Upper bound for a single issuance; issuance is detached from the
+	// caller's cancellation, as its result is shared.
+	issueTimeout = time.Minute
+)
+
+// IssueTokenFunc issues a new token which is valid for (approximately)
+// duration. It returns the token and the time at which it expires; if that is
+// zero, the expiry is taken from the token's claims.
+type IssueTokenFunc func(ctx context.Context, duration time.Duration) (string, time.Time, error)
+
+type CacheOpts struct {
+	// Duration of newly issued tokens. Callers that require a longer minimum
+	// duration get longer tokens. Defaults to one hour.
+	Duration time.Duration
+
+	// When a cached token would no longer satisfy a request within this
+	// window, a new one is issued in the background while the cached one
+	// continues to be handed out. Defaults to five minutes.
+	RefreshAhead time.Duration
+
+	// A token to start with, e.g. one issued while validating credentials.
+	// Only used by CachedTokenSource.
+	InitialToken string
+}
+
+// CachedTokenSource returns a TokenSource that reuses the tokens produced by
+// issue for as long as they are valid for the requested minimum duration.
+// Tokens are refreshed in the background ahead of their expiry, and concurrent
+// callers that require a new token share a single issuance. Passing force to
+// IssueToken skips the cached token.
+func CachedTokenSource(issue IssueTokenFunc, opts CacheOpts) api.TokenSource {
+	cache := newRefreshingCache(func(ctx context.Context, dur time.Duration) (string, time.Time, error) {
+		issuedAt := time.Now()
+		token, expiresAt, err := issue(ctx, dur)
+		if err == nil && expiresAt.IsZero() {
+			expiresAt = tokenExpiry(token, issuedAt, dur)
+		}
+
+		return token, expiresAt, err
+	}, opts)
+
+	if opts.InitialToken != "" {
+		now := time.Now()
+		cache.current = &cachedValue[string]{
+			value:     opts.InitialToken,
+			issuedAt:  now,
+			expiresAt: tokenExpiry(opts.InitialToken, now, cache.duration),
+		}
+	}
+
+	return &cachedTokenSource{cache}
+}
+
+type cachedTokenSource struct {
+	cache *refreshingCache[string]
+}
+
+func (c *cachedTokenSource) IssueToken(ctx context.Context, minDuration time.Duration, force bool) (string, error) {
+	return c.cache.get(ctx, minDuration, force)
+}
+
+// IssueCertificateFunc issues a new client certificate which is valid for
+// (approximately) duration.
+type IssueCertificateFunc func(ctx context.Context, duration time.Duration) (tls.Certificate, error)
+
+// CachedCertificateSource returns a CertificateSource that reuses the
+// certificates produced by issue for as long as they are valid for the
+// requested minimum duration. Expiry is determined from the leaf certificate's
+// NotAfter, and certificates are rotated in the background ahead of it.
+func CachedCertificateSource(issue IssueCertificateFunc, opts CacheOpts) api.CertificateSource {
+	return &cachedCertificateSource{newRefreshingCache(certificateIssuer(issue), opts)}
+}
+
+type cachedCertificateSource struct {
+	cache *refreshingCache[tls.Certificate]
+}
+
+func (c *cachedCertificateSource) IssueCertificate(ctx context.Context, minDuration time.Duration, force bool) (tls.Certificate, error) {
+	return c.cache.get(ctx, minDuration, force)
+}
+
+func certificateIssuer(issue IssueCertificateFunc) func(context.Context, time.Duration) (tls.Certificate, time.Time, error) {
+	return func(ctx context.Context, dur time.Duration) (tls.Certificate, time.Time, error) {
+		cert, err := issue(ctx, dur)
+		if err != nil {
+			return tls.Certificate{}, time.Time{}, err
+		}
+
+		leaf, err := leafCertificate(cert)
+		if err != nil {
+			return tls.Certificate{}, time.Time{}, err
+		}
+
+		return cert, leaf.NotAfter, nil
+	}
+}
+
+func leafCertificate(cert tls.Certificate) (*x509.Certificate, error) {
+	if cert.Leaf != nil {
+		return cert.Leaf, nil
+	}
+
+	if len(cert.Certificate) == 0 {
+		return nil, errors.New("certificate chain is empty")
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse leaf certificate: %w", err)
+	}
+
+	return leaf, nil
+}
+
+type refreshingCache[T any] struct {
+	issue        func(context.Context, time.Duration) (T, time.Time, error)
+	duration     time.Duration
+	refreshAhead time.Duration
+
+	mu       sync.Mutex
+	current  *cachedValue[T]
+	inflight *pendingIssue[T]
+}
+
+type cachedValue[T any] struct {
+	value     T
+	issuedAt  time.Time
+	expiresAt time.Time
+}
+
+// refreshDue returns true if a background refresh may be started. Values are
+// not refreshed before half of their lifetime has passed: otherwise, issuers
+// which return values that are shorter-lived than minDuration+refreshAhead
+// (e.g. servers which cap lifetimes) would cause a refresh on every use.
+func (v *cachedValue[T]) refreshDue(now time.Time) bool {
+	return now.Sub(v.issuedAt) >= v.expiresAt.Sub(v.issuedAt)/2
+}
+
+type pendingIssue[T any] struct {
+	done   chan struct{}
+	result cachedValue[T]
+	err    error
+}
+
+func newRefreshingCache[T any](issue func(context.Context, time.Duration) (T, time.Time, error), opts CacheOpts) *refreshingCache[T] {
+	c := &refreshingCache[T]{
+		issue:        issue,
+		duration:     opts.Duration,
+		refreshAhead: opts.RefreshAhead,
+	}
+
+	if c.duration <= 0 {
+		c.duration = defaultCachedDuration
+	}
+
+	if c.refreshAhead <= 0 {
+		c.refreshAhead = defaultRefreshAhead
+	}
+
+	return c
+}
+
+func (c *refreshingCache[T]) get(ctx context.Context, minDuration time.Duration, force bool) (T, error) {
+	var zero T
+
+	for {
+		c.mu.Lock()
+		if !force && c.current != nil {
+			now := time.Now()
+			remaining := c.current.expiresAt.Sub(now)
+			if remaining >= minDuration {
+				if remaining < minDuration+c.refreshAhead && c.inflight == nil && c.current.refreshDue(now) {
+					c.startLocked(ctx, minDuration)
+				}
+
+				v := c.current.value
+				c.mu.Unlock()
+				return v, nil
+			}
+		}
+
+		p := c.inflight
+		joined := p != nil
+		if !joined {
+			p = c.startLocked(ctx, minDuration)
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return zero, ctx.Err()
+		case <-p.done:
+		}
+
+		if p.err != nil {
+			return zero, p.err
+		}
+
+		// An issuance we joined may have been started on behalf of a caller
+		// with a shorter minimum duration; if so, issue our own.
+		if joined && time.Until(p.result.expiresAt) < minDuration {
+			force = true
+			continue
+		}
+
+		return p.result.value, nil
+	}
+}
+
+func (c *refreshingCache[T]) startLocked(ctx context.Context, minDuration time.Duration) *pendingIssue[T] {
+	dur := c.duration
+	if minDuration > dur {
+		dur = minDuration
+	}
+
+	p := &pendingIssue[T]{done: make(chan struct{})}
+	c.inflight = p
+
+	go func() {
+		defer close(p.done)
+
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), issueTimeout)
+		defer cancel()
+
+		issuedAt := time.Now()
+		v, expiresAt, err := c.issue(ctx, dur)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		c.inflight = nil
+		p.err = err
+		if err == nil {
+			p.result = cachedValue[T]{value: v, issuedAt: issuedAt, expiresAt: expiresAt}
+			c.current = &p.result
+		}
+	}()
+
+	return p
+}
+
+// tokenExpiry returns when token expires, falling back to the requested
+// duration if the token does not carry an expiry.
+func tokenExpiry(token string, issuedAt time.Time, duration time.Duration) time.Time {
+	if t, err := ParseToken(token); err == nil && !t.Expiry.IsZero() {
+		return t.Expiry
+	}
+
+	return issuedAt.Add(duration)
+}
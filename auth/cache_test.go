@@ -0,0 +1,235 @@
+package auth_test
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"namespacelabs.dev/integrations/api"
+	"namespacelabs.dev/integrations/auth"
+)
+
+// fakeIssuer issues numbered tokens, which expire after the requested
+// duration unless lifetime is set. If release is set, issuance waits for it.
+type fakeIssuer struct {
+	lifetime time.Duration
+	delay    time.Duration
+	started  chan struct{}
+	release  chan struct{}
+
+	issued atomic.Int32
+}
+
+func (f *fakeIssuer) issue(ctx context.Context, dur time.Duration) (string, time.Time, error) {
+	n := f.issued.Add(1)
+
+	if f.started != nil {
+		select {
+		case f.started <- struct{}{}:
+		default:
+		}
+	}
+
+	if f.release != nil {
+		<-f.release
+	}
+
+	start := time.Now()
+	time.Sleep(f.delay)
+
+	if f.lifetime > 0 {
+		dur = f.lifetime
+	}
+
+	return fmt.Sprintf("token-%d", n), start.Add(dur), nil
+}
+
+func (f *fakeIssuer) waitIssued(t *testing.T, n int32) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for f.issued.Load() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("issued %d tokens, want %d", f.issued.Load(), n)
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func mustIssue(t *testing.T, ts api.TokenSource, minDuration time.Duration, force bool) string {
+	t.Helper()
+
+	token, err := ts.IssueToken(context.Background(), minDuration, force)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+// issueAsync issues a token in the background, as mustIssue can't be called
+// outside of the test's goroutine.
+func issueAsync(t *testing.T, ts api.TokenSource, minDuration time.Duration) <-chan string {
+	ch := make(chan string, 1)
+	go func() {
+		token, err := ts.IssueToken(context.Background(), minDuration, false)
+		if err != nil {
+			t.Error(err)
+		}
+
+		ch <- token
+	}()
+
+	return ch
+}
+
+func TestCachedTokenSourceReuse(t *testing.T) {
+	f := &fakeIssuer{}
+	ts := auth.CachedTokenSource(f.issue, auth.CacheOpts{})
+
+	first := mustIssue(t, ts, 5*time.Minute, false)
+	for i := 0; i < 10; i++ {
+		if got := mustIssue(t, ts, 5*time.Minute, false); got != first {
+			t.Fatalf("got %q, want the cached %q", got, first)
+		}
+	}
+
+	if n := f.issued.Load(); n != 1 {
+		t.Errorf("issued %d tokens, want 1", n)
+	}
+}
+
+func TestCachedTokenSourceConcurrent(t *testing.T) {
+	f := &fakeIssuer{started: make(chan struct{}, 1), release: make(chan struct{})}
+	ts := auth.CachedTokenSource(f.issue, auth.CacheOpts{})
+
+	var pending []<-chan string
+	for i := 0; i < 20; i++ {
+		pending = append(pending, issueAsync(t, ts, 5*time.Minute))
+	}
+
+	<-f.started
+	time.Sleep(10 * time.Millisecond)
+	close(f.release)
+
+	for i, ch := range pending {
+		if token := <-ch; token != "token-1" {
+			t.Errorf("caller %d got %q", i, token)
+		}
+	}
+
+	if got := f.issued.Load(); got != 1 {
+		t.Errorf("issued %d tokens, want 1", got)
+	}
+}
+
+func TestCachedTokenSourceRefreshAhead(t *testing.T) {
+	// The first token is half way through its lifetime once issued, and within
+	// the refresh window.
+	f := &fakeIssuer{lifetime: 200 * time.Millisecond, delay: 100 * time.Millisecond}
+	ts := auth.CachedTokenSource(f.issue, auth.CacheOpts{RefreshAhead: time.Hour})
+
+	if got := mustIssue(t, ts, time.Millisecond, false); got != "token-1" {
+		t.Fatalf("got %q", got)
+	}
+
+	f.lifetime = time.Hour
+
+	// The cached token is still handed out while it's refreshed.
+	if got := mustIssue(t, ts, time.Millisecond, false); got != "token-1" {
+		t.Fatalf("got %q, want the cached token", got)
+	}
+
+	f.waitIssued(t, 2)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for mustIssue(t, ts, time.Millisecond, false) != "token-2" {
+		if time.Now().After(deadline) {
+			t.Fatal("the refreshed token was never used")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCachedTokenSourceShortLifetime(t *testing.T) {
+	// The server caps lifetimes below minDuration+RefreshAhead.
+	f := &fakeIssuer{lifetime: 6 * time.Minute}
+	ts := auth.CachedTokenSource(f.issue, auth.CacheOpts{RefreshAhead: 5 * time.Minute})
+
+	for i := 0; i < 20; i++ {
+		if got := mustIssue(t, ts, time.Minute, false); got != "token-1" {
+			t.Fatalf("got %q, want the cached token", got)
+		}
+	}
+
+	// Any background refresh would have started by now.
+	time.Sleep(20 * time.Millisecond)
+
+	if n := f.issued.Load(); n != 1 {
+		t.Errorf("issued %d tokens, want 1", n)
+	}
+}
+
+func TestCachedTokenSourceForce(t *testing.T) {
+	f := &fakeIssuer{}
+	ts := auth.CachedTokenSource(f.issue, auth.CacheOpts{})
+
+	first := mustIssue(t, ts, 5*time.Minute, false)
+	forced := mustIssue(t, ts, 5*time.Minute, true)
+
+	if forced == first {
+		t.Error("force returned the cached token")
+	}
+
+	if got := mustIssue(t, ts, 5*time.Minute, false); got != forced {
+		t.Errorf("got %q, want the forced token %q", got, forced)
+	}
+
+	if n := f.issued.Load(); n != 2 {
+		t.Errorf("issued %d tokens, want 2", n)
+	}
+}
+
+func TestCachedTokenSourceLongerMinDuration(t *testing.T) {
+	f := &fakeIssuer{started: make(chan struct{}, 1), release: make(chan struct{})}
+	ts := auth.CachedTokenSource(f.issue, auth.CacheOpts{Duration: 10 * time.Minute})
+
+	short := issueAsync(t, ts, time.Minute)
+	<-f.started
+
+	// Joins the pending issuance, which is for a 10 minute token.
+	long := issueAsync(t, ts, 30*time.Minute)
+
+	time.Sleep(10 * time.Millisecond)
+	close(f.release)
+
+	if got := <-short; got != "token-1" {
+		t.Errorf("short: got %q", got)
+	}
+
+	if got := <-long; got != "token-2" {
+		t.Errorf("long: got %q, want a token of its own", got)
+	}
+
+	if n := f.issued.Load(); n != 2 {
+		t.Errorf("issued %d tokens, want 2", n)
+	}
+}
+
+func TestCachedTokenSourceInitialToken(t *testing.T) {
+	f := &fakeIssuer{}
+	ts := auth.CachedTokenSource(f.issue, auth.CacheOpts{InitialToken: "initial"})
+
+	// Without claims, the initial token lasts for the default duration.
+	if got := mustIssue(t, ts, 5*time.Minute, false); got != "initial" {
+		t.Errorf("got %q", got)
+	}
+
+	if n := f.issued.Load(); n != 0 {
+		t.Errorf("issued %d tokens, want 0", n)
+	}
+}
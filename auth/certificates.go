@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	iamv1beta "buf.build/gen/go/namespace/cloud/protocolbuffers/go/proto/namespace/cloud/iam/v1beta"
+	"namespacelabs.dev/integrations/api"
+	"namespacelabs.dev/integrations/api/iam"
+	"namespacelabs.dev/integrations/nsc/apienv"
+)
+
+// WithCertificates returns a source which, in addition to the tokens of src,
+// issues tenant client certificates by exchanging those tokens with IAM. If
+// src already issues certificates, it is returned as is.
+func WithCertificates(src api.TokenSource) api.TokenAndCertificateSource {
+	if tcs, ok := src.(api.TokenAndCertificateSource); ok {
+		return tcs
+	}
+
+	return tokenAndCertificates{src, newCertificateExchange(src, "")}
+}
+
+type tokenAndCertificates struct {
+	api.TokenSource
+	api.CertificateSource
+}
+
+// certificateExchange issues client certificates for the tenant that the
+// tokens of its source belong to. The private key is generated locally, and
+// only its public key is sent to IAM.
+type certificateExchange struct {
+	token       api.TokenSource
+	iamEndpoint string
+
+	mu     sync.Mutex
+	client *iam.Client
+}
+
+func newCertificateExchange(token api.TokenSource, iamEndpoint string) api.CertificateSource {
+	x := &certificateExchange{token: token, iamEndpoint: iamEndpoint}
+	return CachedCertificateSource(x.issue, CacheOpts{})
+}
+
+func (x *certificateExchange) iamClient(ctx context.Context) (*iam.Client, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.client == nil {
+		endpoint := x.iamEndpoint
+		if endpoint == "" {
+			endpoint = apienv.IAMEndpoint()
+		}
+
+		cli, err := iam.NewClientWithEndpoint(ctx, endpoint, x.token)
+		if err != nil {
+			return nil, err
+		}
+
+		x.client = &cli
+	}
+
+	return x.client, nil
+}
+
+func (x *certificateExchange) issue(ctx context.Context, dur time.Duration) (tls.Certificate, error) {
+	token, err := x.token.IssueToken(ctx, 5*time.Minute, false)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	claims, err := ExtractClaims(token)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("unable to determine the tenant to issue a certificate for: %w", err)
+	}
+
+	if claims.TenantID == "" {
+		return tls.Certificate{}, errors.New("unable to determine the tenant to issue a certificate for")
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	cli, err := x.iamClient(ctx)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	resp, err := cli.Tenants.IssueTenantClientCertificate(ctx, &iamv1beta.IssueTenantClientCertificateRequest{
+		TenantId:     claims.TenantID,
+		DurationSecs: int64(dur.Seconds()),
+		PublicKeyPem: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})),
+	})
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	if resp.PrivateKeyPem != "" {
+		// The server chose the key pair.
+		return tls.X509KeyPair([]byte(resp.ClientCertificatePem), []byte(resp.PrivateKeyPem))
+	}
+
+	priv, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.X509KeyPair([]byte(resp.ClientCertificatePem), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: priv}))
+}
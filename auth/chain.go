@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"namespacelabs.dev/integrations/api"
+	"namespacelabs.dev/integrations/nsc/profile"
+)
+
+// ErrNoCredentials is returned (wrapped) by providers that have no
+// credentials available. A Chain moves on to its next provider when it sees
+// it; any other error stops the chain.
+var ErrNoCredentials = errors.New("no credentials available")
+
+const workloadTokenPath = "/var/run/nsc/token.json"
+
+// Provider is a named source of credentials which can take part in a Chain.
+type Provider struct {
+	Name string
+	Load func() (api.TokenSource, error)
+}
+
+// Chain tries each of its providers in order, and uses the first one that
+// has credentials available.
+type Chain struct {
+	Providers []Provider
+}
+
+// Resolution records how a Chain obtained its credentials.
+type Resolution struct {
+	Attempts []Attempt `json:"attempts"`
+
+	// Name of the provider whose credentials were used.
+	Selected string `json:"selected,omitempty"`
+
+	// Details of the selected token, if known.
+	TokenKind TokenKind  `json:"token_kind,omitempty"`
+	TenantID  string     `json:"tenant_id,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type Attempt struct {
+	Provider string `json:"provider"`
+	// Why the provider was skipped, or why it failed. Empty if it was selected.
+	Reason string `json:"reason,omitempty"`
+	// Set if the provider failed, which stops the chain.
+	Failed bool `json:"failed,omitempty"`
+}
+
+// DefaultChain returns the chain used by LoadDefaults: the token file in
+// NSC_TOKEN_FILE, then the workload token of the instance, and finally the
+// token left behind by `nsc login`.
+func DefaultChain() Chain {
+	return Chain{
+		Providers: []Provider{
+			EnvTokenFileProvider(),
+			TokenFileProvider("workload", workloadTokenPath),
+			UserTokenProvider(),
+		},
+	}
+}
+
+// EnvTokenFileProvider loads the token file referred to by NSC_TOKEN_FILE.
+func EnvTokenFileProvider() Provider {
+	return Provider{
+		Name: "env",
+		Load: func() (api.TokenSource, error) {
+			tf := os.Getenv("NSC_TOKEN_FILE")
+			if tf == "" {
+				return nil, noCredentials("NSC_TOKEN_FILE is not set")
+			}
+
+			return loadFromFile(tf)
+		},
+	}
+}
+
+// TokenFileProvider loads the token file at path, if it exists.
+func TokenFileProvider(name, path string) Provider {
+	return Provider{
+		Name: name,
+		Load: func() (api.TokenSource, error) {
+			t, err := loadFromFile(path)
+			if os.IsNotExist(err) {
+				return nil, noCredentials(fmt.Sprintf("%s does not exist", path))
+			}
+
+			return t, err
+		},
+	}
+}
+
+// UserTokenProvider loads the token written by `nsc login` for the active
+// profile.
+func UserTokenProvider() Provider {
+	return Provider{
+		Name: "user",
+		Load: LoadUserToken,
+	}
+}
+
+// Load returns the credentials of the first provider that has them.
+func (c Chain) Load() (api.TokenSource, error) {
+	t, _, err := c.Resolve()
+	return t, err
+}
+
+// Resolve is like Load, but also returns a record of which providers were
+// tried, and why they were skipped.
+func (c Chain) Resolve() (api.TokenSource, *Resolution, error) {
+	res := &Resolution{}
+
+	lastErr := error(noCredentials("no credential providers configured"))
+	for _, p := range c.Providers {
+		t, err := p.Load()
+		if err != nil {
+			if errors.Is(err, ErrNoCredentials) {
+				res.Attempts = append(res.Attempts, Attempt{Provider: p.Name, Reason: err.Error()})
+				lastErr = err
+				continue
+			}
+
+			res.Attempts = append(res.Attempts, Attempt{Provider: p.Name, Reason: err.Error(), Failed: true})
+			return nil, res, err
+		}
+
+		res.Attempts = append(res.Attempts, Attempt{Provider: p.Name})
+		res.Selected = p.Name
+		res.describeToken(t)
+		return t, res, nil
+	}
+
+	return nil, res, lastErr
+}
+
+func (r *Resolution) describeToken(ts api.TokenSource) {
+	lt, ok := ts.(*loadedToken)
+	if !ok {
+		return
+	}
+
+	raw := lt.BearerToken
+	if lt.SessionToken != "" {
+		raw = lt.SessionToken
+	}
+
+	t, err := ParseToken(raw)
+	if err != nil {
+		return
+	}
+
+	r.TokenKind = t.Kind
+	r.TenantID = t.TenantID
+	if !t.Expiry.IsZero() {
+		r.ExpiresAt = &t.Expiry
+	}
+}
+
+// Describe returns a human-readable summary of the resolution.
+func (r *Resolution) Describe() string {
+	var b strings.Builder
+
+	for _, a := range r.Attempts {
+		switch {
+		case a.Failed:
+			fmt.Fprintf(&b, "%s: failed: %s\n", a.Provider, a.Reason)
+		case a.Reason == "":
+			fmt.Fprintf(&b, "%s: selected\n", a.Provider)
+		default:
+			fmt.Fprintf(&b, "%s: skipped: %s\n", a.Provider, a.Reason)
+		}
+	}
+
+	if r.Selected == "" {
+		b.WriteString("No credentials found.\n")
+		return b.String()
+	}
+
+	if r.TokenKind != TokenKindUnknown {
+		fmt.Fprintf(&b, "Token: %s", r.TokenKind)
+		if r.TenantID != "" {
+			fmt.Fprintf(&b, ", tenant %s", r.TenantID)
+		}
+		if r.ExpiresAt != nil {
+			fmt.Fprintf(&b, ", expires %s", r.ExpiresAt.Format(time.RFC3339))
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+type noCredentialsError struct {
+	reason string
+}
+
+func noCredentials(reason string) error {
+	return noCredentialsError{reason}
+}
+
+func (e noCredentialsError) Error() string { return e.reason }
+
+func (e noCredentialsError) Is(target error) bool { return target == ErrNoCredentials }
+
+func userTokenPath(name string) (string, error) {
+	dir, err := profile.Dir(name)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "token.json"), nil
+}
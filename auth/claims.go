@@ -2,44 +2,166 @@ package auth
 
 import (
 	"errors"
+	"fmt"
 	"strings"
+	"time"
 
-	"github.com/golang-jwt/jwt/v4"
+	"namespacelabs.dev/integrations/auth/tokenclaims"
 )
 
 var ErrNotLoggedIn = errors.New("not logged in")
 
-type TokenClaims struct {
-	jwt.RegisteredClaims
+type TokenClaims = tokenclaims.Claims
 
-	TenantID       string `json:"tenant_id"`
-	ActorID        string `json:"actor_id"`
-	InstanceID     string `json:"instance_id"`
-	OwnerID        string `json:"owner_id"`
-	PrimaryRegion  string `json:"primary_region"`
-	WorkloadRegion string `json:"workload_region"`
+// TokenKind identifies the kind of a token, based on its prefix.
+type TokenKind int
+
+const (
+	TokenKindUnknown TokenKind = iota
+	// A user session, obtained with `nsc login` ("st_").
+	TokenKindSession
+	// A tenant token ("nsct_").
+	TokenKindTenant
+	// An instance workload token ("nscw_").
+	TokenKindWorkload
+	// An OpenID token issued by Cognito for partner federation ("cognito_").
+	TokenKindCognito
+)
+
+// Each kind of token is its prefix followed by a JWT.
+var tokenKinds = []struct {
+	kind   TokenKind
+	prefix string
+	name   string
+}{
+	{TokenKindSession, "st_", "session"},
+	{TokenKindTenant, "nsct_", "tenant"},
+	{TokenKindWorkload, "nscw_", "workload"},
+	{TokenKindCognito, "cognito_", "cognito"},
+}
+
+func (k TokenKind) String() string {
+	for _, tk := range tokenKinds {
+		if tk.kind == k {
+			return tk.name
+		}
+	}
+
+	return "unknown"
+}
+
+func (k TokenKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+func (k *TokenKind) UnmarshalText(text []byte) error {
+	if string(text) == "unknown" {
+		*k = TokenKindUnknown
+		return nil
+	}
+
+	for _, tk := range tokenKinds {
+		if tk.name == string(text) {
+			*k = tk.kind
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unrecognized token kind %q", text)
+}
+
+// KindOf returns the kind of token, based on its prefix.
+func KindOf(token string) TokenKind {
+	for _, tk := range tokenKinds {
+		if strings.HasPrefix(token, tk.prefix) {
+			return tk.kind
+		}
+	}
+
+	return TokenKindUnknown
+}
+
+// Token is a parsed Namespace token. Its claims are not verified; use a
+// Verifier when they are used to make trust decisions.
+type Token struct {
+	Raw  string
+	Kind TokenKind
+
+	Claims *TokenClaims
+
+	// Zero if the token doesn't carry an expiry.
+	Expiry time.Time
+
+	TenantID   string
+	InstanceID string
+	// The workload region of the token, or otherwise the tenant's primary region.
+	Region string
 }
 
+// ParseToken parses the prefix and the claims of a Namespace token.
+func ParseToken(raw string) (*Token, error) {
+	t := &Token{Raw: raw, Kind: KindOf(raw)}
+
+	if t.Kind == TokenKindUnknown {
+		return nil, fmt.Errorf("%w: unrecognized token format", ErrTokenMalformed)
+	}
+
+	jwtPart, _ := tokenJWT(raw)
+	claims, err := parseClaims(jwtPart)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTokenMalformed, err)
+	}
+
+	t.Claims = claims
+	t.TenantID = claims.TenantID
+	t.InstanceID = claims.InstanceID
+	t.Region = claims.Region()
+
+	if claims.ExpiresAt != nil {
+		t.Expiry = claims.ExpiresAt.Time
+	}
+
+	return t, nil
+}
+
+func (t *Token) IsSession() bool  { return t.Kind == TokenKindSession }
+func (t *Token) IsTenant() bool   { return t.Kind == TokenKindTenant }
+func (t *Token) IsWorkload() bool { return t.Kind == TokenKindWorkload }
+
+// ValidFor returns true if the token does not expire within d. Tokens without
+// an expiry are always valid.
+func (t *Token) ValidFor(d time.Duration) bool {
+	return t.Expiry.IsZero() || time.Now().Add(d).Before(t.Expiry)
+}
+
+// ExtractClaims returns the claims of a Namespace token, without verifying its
+// signature. Use a Verifier when the claims are used to make trust decisions.
 func ExtractClaims(token string) (*TokenClaims, error) {
-	switch {
-	case strings.HasPrefix(token, "st_"):
-		return parseClaims(strings.TrimPrefix(token, "st_"))
-	case strings.HasPrefix(token, "nsct_"):
-		return parseClaims(strings.TrimPrefix(token, "nsct_"))
-	case strings.HasPrefix(token, "nscw_"):
-		return parseClaims(strings.TrimPrefix(token, "nscw_"))
+	switch KindOf(token) {
+	case TokenKindSession, TokenKindTenant, TokenKindWorkload:
+		raw, _ := tokenJWT(token)
+		return parseClaims(raw)
 	default:
 		return nil, ErrNotLoggedIn
 	}
 }
 
-func parseClaims(raw string) (*TokenClaims, error) {
-	parser := jwt.Parser{}
+// tokenJWT returns the JWT embedded in a Namespace token.
+func tokenJWT(token string) (string, bool) {
+	for _, tk := range tokenKinds {
+		if strings.HasPrefix(token, tk.prefix) {
+			return strings.TrimPrefix(token, tk.prefix), true
+		}
+	}
 
-	var claims TokenClaims
-	if _, _, err := parser.ParseUnverified(raw, &claims); err != nil {
+	return "", false
+}
+
+func parseClaims(raw string) (*TokenClaims, error) {
+	claims, err := tokenclaims.ParseJWT(raw)
+	if err != nil {
 		return nil, ErrNotLoggedIn
 	}
 
-	return &claims, nil
+	return claims, nil
 }
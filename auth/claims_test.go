@@ -0,0 +1,172 @@
+package auth_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"namespacelabs.dev/integrations/auth"
+)
+
+func signJWT(t *testing.T, claims auth.TokenClaims) string {
+	t.Helper()
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+func TestKindOf(t *testing.T) {
+	for _, tc := range []struct {
+		token string
+		want  auth.TokenKind
+	}{
+		{"st_abc", auth.TokenKindSession},
+		{"nsct_abc", auth.TokenKindTenant},
+		{"nscw_abc", auth.TokenKindWorkload},
+		{"cognito_abc", auth.TokenKindCognito},
+		{"abc", auth.TokenKindUnknown},
+		{"nsc_abc", auth.TokenKindUnknown},
+		{"ST_abc", auth.TokenKindUnknown},
+		{"", auth.TokenKindUnknown},
+	} {
+		if got := auth.KindOf(tc.token); got != tc.want {
+			t.Errorf("KindOf(%q) = %v, want %v", tc.token, got, tc.want)
+		}
+	}
+}
+
+func TestTokenKindText(t *testing.T) {
+	for _, k := range []auth.TokenKind{auth.TokenKindUnknown, auth.TokenKindSession, auth.TokenKindTenant, auth.TokenKindWorkload, auth.TokenKindCognito} {
+		text, err := k.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got auth.TokenKind
+		if err := got.UnmarshalText(text); err != nil {
+			t.Fatalf("UnmarshalText(%q): %v", text, err)
+		}
+
+		if got != k {
+			t.Errorf("UnmarshalText(%q) = %v, want %v", text, got, k)
+		}
+	}
+
+	var k auth.TokenKind
+	if err := k.UnmarshalText([]byte("bogus")); err == nil {
+		t.Error("UnmarshalText(bogus) succeeded")
+	}
+}
+
+func TestParseToken(t *testing.T) {
+	expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	claims := auth.TokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(expiry)},
+		TenantID:         "tenant-1",
+		InstanceID:       "instance-1",
+		PrimaryRegion:    "us",
+		WorkloadRegion:   "eu",
+	}
+
+	for _, prefix := range []struct {
+		prefix string
+		kind   auth.TokenKind
+	}{
+		{"st_", auth.TokenKindSession},
+		{"nsct_", auth.TokenKindTenant},
+		{"nscw_", auth.TokenKindWorkload},
+		{"cognito_", auth.TokenKindCognito},
+	} {
+		tok, err := auth.ParseToken(prefix.prefix + signJWT(t, claims))
+		if err != nil {
+			t.Fatalf("%s: %v", prefix.prefix, err)
+		}
+
+		if tok.Kind != prefix.kind {
+			t.Errorf("%s: kind = %v, want %v", prefix.prefix, tok.Kind, prefix.kind)
+		}
+
+		if tok.TenantID != "tenant-1" || tok.InstanceID != "instance-1" {
+			t.Errorf("%s: got tenant %q, instance %q", prefix.prefix, tok.TenantID, tok.InstanceID)
+		}
+
+		if tok.Region != "eu" {
+			t.Errorf("%s: region = %q, want the workload region", prefix.prefix, tok.Region)
+		}
+
+		if !tok.Expiry.Equal(expiry) {
+			t.Errorf("%s: expiry = %v, want %v", prefix.prefix, tok.Expiry, expiry)
+		}
+
+		if !tok.ValidFor(30*time.Minute) || tok.ValidFor(2*time.Hour) {
+			t.Errorf("%s: unexpected validity", prefix.prefix)
+		}
+	}
+
+	claims.WorkloadRegion = ""
+	claims.ExpiresAt = nil
+	tok, err := auth.ParseToken("nsct_" + signJWT(t, claims))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tok.Region != "us" {
+		t.Errorf("region = %q, want the primary region", tok.Region)
+	}
+
+	if !tok.Expiry.IsZero() || !tok.ValidFor(24*time.Hour) {
+		t.Errorf("a token without an expiry should always be valid")
+	}
+
+	if !tok.IsTenant() || tok.IsSession() || tok.IsWorkload() {
+		t.Errorf("unexpected kind helpers for %v", tok.Kind)
+	}
+}
+
+func TestParseTokenMalformed(t *testing.T) {
+	valid := signJWT(t, auth.TokenClaims{TenantID: "tenant-1"})
+
+	for _, raw := range []string{
+		"",
+		// Not a Namespace token.
+		valid,
+		"bearer_" + valid,
+		// An opaque value where a JWT is expected.
+		"nsct_opaque",
+		"st_",
+		"nscw_a.b.c",
+		// A truncated JWT.
+		"nsct_" + valid[:len(valid)/2],
+	} {
+		if _, err := auth.ParseToken(raw); !errors.Is(err, auth.ErrTokenMalformed) {
+			t.Errorf("ParseToken(%q) = %v, want ErrTokenMalformed", raw, err)
+		}
+	}
+}
+
+func TestExtractClaims(t *testing.T) {
+	raw := signJWT(t, auth.TokenClaims{TenantID: "tenant-1"})
+
+	for _, prefix := range []string{"st_", "nsct_", "nscw_"} {
+		claims, err := auth.ExtractClaims(prefix + raw)
+		if err != nil {
+			t.Fatalf("%s: %v", prefix, err)
+		}
+
+		if claims.TenantID != "tenant-1" {
+			t.Errorf("%s: tenant = %q", prefix, claims.TenantID)
+		}
+	}
+
+	for _, token := range []string{"cognito_" + raw, raw, "nsct_opaque"} {
+		if _, err := auth.ExtractClaims(token); !errors.Is(err, auth.ErrNotLoggedIn) {
+			t.Errorf("ExtractClaims(%q) = %v, want ErrNotLoggedIn", token, err)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"namespacelabs.dev/integrations/nsc/logging"
+)
+
+// Exported for tests in auth_test.
+
+const (
+	TokenCacheName       = tokenCacheName
+	TokenCacheLockName   = tokenCacheLockName
+	MaxTokenCacheEntries = maxTokenCacheEntries
+)
+
+var LockFile = lockFile
+
+// IssueFromDiskCache returns a token for tenantID from the token cache in dir,
+// or calls issue and caches its result.
+func IssueFromDiskCache(ctx context.Context, dir, tenantID string, minDur time.Duration, issue func(context.Context) (string, error)) (string, error) {
+	return diskTokenCache{dir: dir, debugLog: logging.Discard}.issue(ctx, tenantID, minDur, issue)
+}
+
+// LoadPolledLocalToken is LoadLocalToken without a watch, as on platforms
+// without inotify.
+func LoadPolledLocalToken(path string) (*LocalToken, error) {
+	return loadLocalToken(path, nil)
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package auth
+
+import "context"
+
+// lockFile is a no-op on platforms without flock; the token cache is still
+// replaced atomically.
+func lockFile(ctx context.Context, path string) (func(), error) {
+	return func() {}, nil
+}
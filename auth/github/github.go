@@ -0,0 +1,162 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"namespacelabs.dev/integrations/api"
+	"namespacelabs.dev/integrations/auth"
+	"namespacelabs.dev/integrations/nsc/apienv"
+	"namespacelabs.dev/integrations/nsc/jsonapi"
+	"namespacelabs.dev/integrations/nsc/telemetry"
+)
+
+const DefaultAudience = "namespace.so"
+
+type FederationOpts struct {
+	// Audience of the requested GitHub ID token. Defaults to DefaultAudience.
+	Audience string
+
+	// Where to request ID tokens from, and the bearer token used to do so.
+	// Default to ACTIONS_ID_TOKEN_REQUEST_URL and ACTIONS_ID_TOKEN_REQUEST_TOKEN.
+	RequestURL   string
+	RequestToken string
+
+	// The IAM endpoint to exchange ID tokens with. Defaults to the configured
+	// IAM endpoint.
+	IAMEndpoint string
+
+	// Used for all requests. Defaults to telemetry.HTTPClient.
+	HTTPClient *http.Client
+}
+
+// Federation returns a TokenSource which exchanges the GitHub Actions OIDC
+// token of the current workflow run for a Namespace tenant token. The workflow
+// requires the `id-token: write` permission.
+//
+// A first tenant token is obtained with ctx, so that a misconfigured workflow
+// fails here rather than on first use.
+func Federation(ctx context.Context, audience string) (api.TokenSource, error) {
+	if os.Getenv("ACTIONS_ID_TOKEN_REQUEST_URL") == "" || os.Getenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN") == "" {
+		return nil, errors.New("GitHub Actions OIDC tokens are not available; does the workflow have the `id-token: write` permission?")
+	}
+
+	f := newFederation(FederationOpts{Audience: audience})
+
+	token, _, err := f.issue(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return auth.CachedTokenSource(f.issue, auth.CacheOpts{InitialToken: token}), nil
+}
+
+// FederationWithOpts is like Federation, but allows overriding where ID tokens
+// are obtained from and exchanged. Tenant tokens are cached until near their
+// expiry.
+func FederationWithOpts(opts FederationOpts) api.TokenSource {
+	return auth.CachedTokenSource(newFederation(opts).issue, auth.CacheOpts{})
+}
+
+func newFederation(opts FederationOpts) federation {
+	if opts.Audience == "" {
+		opts.Audience = DefaultAudience
+	}
+
+	if opts.RequestURL == "" {
+		opts.RequestURL = os.Getenv("ACTIONS_ID_TOKEN_REQUEST_URL")
+	}
+
+	if opts.RequestToken == "" {
+		opts.RequestToken = os.Getenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN")
+	}
+
+	if opts.IAMEndpoint == "" {
+		opts.IAMEndpoint = apienv.IAMEndpoint()
+	}
+
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = telemetry.HTTPClient
+	}
+
+	return federation{opts}
+}
+
+type federation struct {
+	opts FederationOpts
+}
+
+func (f federation) issue(ctx context.Context, dur time.Duration) (string, time.Time, error) {
+	idToken, err := f.idToken(ctx)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	token, err := f.exchange(ctx, idToken)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	// The expiry is determined from the token's claims.
+	return token, time.Time{}, nil
+}
+
+func (f federation) idToken(ctx context.Context) (string, error) {
+	if f.opts.RequestURL == "" || f.opts.RequestToken == "" {
+		return "", errors.New("GitHub Actions OIDC request URL and token are required")
+	}
+
+	u, err := url.Parse(f.opts.RequestURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid ID token request URL: %w", err)
+	}
+
+	q := u.Query()
+	q.Set("audience", f.opts.Audience)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+f.opts.RequestToken)
+	req.Header.Set("Accept", "application/json")
+
+	var resp struct {
+		Value string `json:"value"`
+	}
+
+	if err := jsonapi.Do(f.opts.HTTPClient, req, &resp); err != nil {
+		return "", fmt.Errorf("failed to obtain GitHub ID token: %w", err)
+	}
+
+	if resp.Value == "" {
+		return "", errors.New("GitHub ID token was missing")
+	}
+
+	return resp.Value, nil
+}
+
+func (f federation) exchange(ctx context.Context, idToken string) (string, error) {
+	var resp struct {
+		TenantToken string `json:"tenant_token"`
+	}
+
+	if err := jsonapi.Call(ctx, f.opts.HTTPClient, f.opts.IAMEndpoint, "nsl.tenants.TenantsService/ExchangeGithubToken", "", map[string]string{
+		"github_token": idToken,
+	}, &resp); err != nil {
+		return "", fmt.Errorf("failed to exchange GitHub ID token: %w", err)
+	}
+
+	if resp.TenantToken == "" {
+		return "", errors.New("tenant token was missing")
+	}
+
+	return resp.TenantToken, nil
+}
@@ -0,0 +1,163 @@
+package github_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"namespacelabs.dev/integrations/auth/github"
+)
+
+// fakeActions serves both the Actions ID token endpoint and the IAM token
+// exchange.
+type fakeActions struct {
+	tenantToken string
+
+	idTokens  atomic.Int32
+	exchanges atomic.Int32
+}
+
+func (f *fakeActions) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/actions/token":
+		f.idTokens.Add(1)
+
+		if got := r.Header.Get("Authorization"); got != "Bearer request-token" {
+			http.Error(w, "unexpected authorization "+got, http.StatusUnauthorized)
+			return
+		}
+
+		if got := r.URL.Query().Get("audience"); got != "test-audience" {
+			http.Error(w, "unexpected audience "+got, http.StatusBadRequest)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]string{"value": "github-id-token"})
+
+	case "/nsl.tenants.TenantsService/ExchangeGithubToken":
+		f.exchanges.Add(1)
+
+		var req map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req["github_token"] != "github-id-token" {
+			http.Error(w, "unexpected exchange request", http.StatusBadRequest)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]string{"tenant_token": f.tenantToken})
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func startFakeActions(t *testing.T) (*fakeActions, *httptest.Server) {
+	t.Helper()
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"tenant_id": "tenant-1",
+		"exp":       time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fakeActions{tenantToken: "nsct_" + signed}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	t.Setenv("ACTIONS_ID_TOKEN_REQUEST_URL", srv.URL+"/actions/token?api-version=2.0")
+	t.Setenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN", "request-token")
+	t.Setenv("NSC_IAM_ENDPOINT", srv.URL)
+
+	return f, srv
+}
+
+func TestFederation(t *testing.T) {
+	f, _ := startFakeActions(t)
+
+	ctx := context.Background()
+	ts, err := github.Federation(ctx, "test-audience")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := ts.IssueToken(ctx, 5*time.Minute, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token != f.tenantToken {
+		t.Errorf("got token %q, want %q", token, f.tenantToken)
+	}
+
+	// The token obtained by Federation is cached.
+	if f.idTokens.Load() != 1 || f.exchanges.Load() != 1 {
+		t.Errorf("%d ID token requests and %d exchanges, want 1 each", f.idTokens.Load(), f.exchanges.Load())
+	}
+}
+
+func TestFederationCanceled(t *testing.T) {
+	f, srv := startFakeActions(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := github.Federation(ctx, "test-audience"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+
+	// Close waits for any request which is still being served.
+	srv.Close()
+
+	if f.idTokens.Load() != 0 || f.exchanges.Load() != 0 {
+		t.Errorf("%d ID token requests and %d exchanges with a canceled context", f.idTokens.Load(), f.exchanges.Load())
+	}
+}
+
+func TestFederationUnavailable(t *testing.T) {
+	t.Setenv("ACTIONS_ID_TOKEN_REQUEST_URL", "")
+	t.Setenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN", "")
+
+	if _, err := github.Federation(context.Background(), ""); err == nil {
+		t.Fatal("Federation succeeded without an ID token request URL")
+	}
+}
+
+func TestFederationWithOpts(t *testing.T) {
+	f, srv := startFakeActions(t)
+
+	ts := github.FederationWithOpts(github.FederationOpts{
+		Audience:     "test-audience",
+		RequestURL:   srv.URL + "/actions/token",
+		RequestToken: "request-token",
+		IAMEndpoint:  srv.URL,
+		HTTPClient:   srv.Client(),
+	})
+
+	token, err := ts.IssueToken(context.Background(), 5*time.Minute, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token != f.tenantToken {
+		t.Errorf("got token %q, want %q", token, f.tenantToken)
+	}
+
+	bad := github.FederationWithOpts(github.FederationOpts{
+		Audience:     "test-audience",
+		RequestURL:   srv.URL + "/actions/token",
+		RequestToken: "wrong-token",
+		IAMEndpoint:  srv.URL,
+		HTTPClient:   srv.Client(),
+	})
+
+	if _, err := bad.IssueToken(context.Background(), 5*time.Minute, false); err == nil {
+		t.Fatal("IssueToken succeeded with a rejected request token")
+	}
+}
@@ -0,0 +1,155 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"namespacelabs.dev/integrations/api"
+	"namespacelabs.dev/integrations/auth"
+	"namespacelabs.dev/integrations/nsc/apienv"
+	"namespacelabs.dev/integrations/nsc/jsonapi"
+	"namespacelabs.dev/integrations/nsc/telemetry"
+)
+
+// Where kubelet mounts the default service account token.
+const DefaultTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// exchangeOIDCTokenMethod is served by IAM as JSON. It's part of the private
+// nsl.tenants.TenantsService, which isn't published with the public API protos
+// (buf.build/namespace/cloud), so there's no generated client; see
+// exchangeRequest and exchangeResponse for its messages.
+const exchangeOIDCTokenMethod = "nsl.tenants.TenantsService/ExchangeOIDCToken"
+
+type FederationOpts struct {
+	// Path to the projected service account token. Defaults to DefaultTokenPath.
+	TokenPath string
+
+	// The IAM endpoint to exchange service account tokens with. Defaults to
+	// the configured IAM endpoint.
+	IAMEndpoint string
+
+	// Used to exchange tokens. Defaults to telemetry.HTTPClient.
+	HTTPClient *http.Client
+
+	// If set, the service account token must be issued for this audience, and
+	// is not sent to IAM otherwise. This prevents the pod's default token,
+	// which grants access to the Kubernetes API, from being exchanged.
+	Audience string
+}
+
+// Federation returns a TokenSource which exchanges the pod's projected service
+// account token for a token of the specified Namespace tenant. The tenant must
+// trust the cluster's service account issuer.
+func Federation(tenantId string) api.TokenSource {
+	return FederationWithOpts(tenantId, FederationOpts{})
+}
+
+// FederationWithOpts is like Federation, but allows overriding where the
+// service account token is read from, and where it is exchanged. Exchanged
+// tokens are cached until near their expiry.
+func FederationWithOpts(tenantId string, opts FederationOpts) api.TokenSource {
+	if opts.TokenPath == "" {
+		opts.TokenPath = DefaultTokenPath
+	}
+
+	if opts.IAMEndpoint == "" {
+		opts.IAMEndpoint = apienv.IAMEndpoint()
+	}
+
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = telemetry.HTTPClient
+	}
+
+	f := &federation{tenantId: tenantId, opts: opts}
+	return auth.CachedTokenSource(f.issue, auth.CacheOpts{})
+}
+
+type federation struct {
+	tenantId string
+	opts     FederationOpts
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	token   string
+}
+
+func (f *federation) issue(ctx context.Context, dur time.Duration) (string, time.Time, error) {
+	saToken, err := f.serviceAccountToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	var resp exchangeResponse
+	if err := jsonapi.Call(ctx, f.opts.HTTPClient, f.opts.IAMEndpoint, exchangeOIDCTokenMethod, "", exchangeRequest{
+		TenantID:  f.tenantId,
+		OIDCToken: saToken,
+	}, &resp); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to exchange service account token: %w", err)
+	}
+
+	if resp.TenantToken == "" {
+		return "", time.Time{}, errors.New("tenant token was missing")
+	}
+
+	// The expiry is determined from the token's claims.
+	return resp.TenantToken, time.Time{}, nil
+}
+
+type exchangeRequest struct {
+	TenantID  string `json:"tenant_id"`
+	OIDCToken string `json:"oidc_token"`
+}
+
+type exchangeResponse struct {
+	TenantToken string `json:"tenant_token"`
+}
+
+// serviceAccountToken returns the contents of the token file, re-reading it
+// if kubelet has rotated it since it was last read.
+func (f *federation) serviceAccountToken() (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	st, err := os.Stat(f.opts.TokenPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read service account token: %w", err)
+	}
+
+	if f.token != "" && st.ModTime().Equal(f.modTime) && st.Size() == f.size {
+		return f.token, nil
+	}
+
+	contents, err := os.ReadFile(f.opts.TokenPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read service account token: %w", err)
+	}
+
+	token := string(bytes.TrimSpace(contents))
+	if token == "" {
+		return "", errors.New("service account token is empty")
+	}
+
+	if f.opts.Audience != "" {
+		var claims jwt.RegisteredClaims
+		if _, _, err := jwt.NewParser().ParseUnverified(token, &claims); err != nil {
+			return "", fmt.Errorf("failed to parse service account token: %w", err)
+		}
+
+		if !claims.VerifyAudience(f.opts.Audience, true) {
+			return "", fmt.Errorf("service account token is not issued for %q (audience %v)", f.opts.Audience, claims.Audience)
+		}
+	}
+
+	f.token = token
+	f.modTime = st.ModTime()
+	f.size = st.Size()
+	return token, nil
+}
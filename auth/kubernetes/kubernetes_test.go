@@ -0,0 +1,138 @@
+package kubernetes_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"namespacelabs.dev/integrations/auth"
+	"namespacelabs.dev/integrations/auth/authtest"
+	"namespacelabs.dev/integrations/auth/kubernetes"
+)
+
+// writeServiceAccountToken writes a service account token for audience, as
+// kubelet does when it rotates projected tokens.
+func writeServiceAccountToken(t *testing.T, path, subject, audience string) string {
+	t.Helper()
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   subject,
+		Audience:  jwt.ClaimStrings{audience},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}).SignedString([]byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path+".tmp", []byte(signed+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Rename(path+".tmp", path); err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+func startIAM(t *testing.T) (*authtest.IAMServer, *httptest.Server) {
+	t.Helper()
+
+	iam, err := authtest.NewIAMServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(iam.Close)
+
+	srv := httptest.NewServer(iam)
+	t.Cleanup(srv.Close)
+
+	return iam, srv
+}
+
+func TestFederation(t *testing.T) {
+	iam, srv := startIAM(t)
+
+	path := filepath.Join(t.TempDir(), "token")
+	first := writeServiceAccountToken(t, path, "system:serviceaccount:default:builder", "namespace.so")
+
+	ts := kubernetes.FederationWithOpts("tenant-1", kubernetes.FederationOpts{
+		TokenPath:   path,
+		IAMEndpoint: srv.URL,
+		HTTPClient:  srv.Client(),
+		Audience:    "namespace.so",
+	})
+
+	ctx := context.Background()
+	token, err := ts.IssueToken(ctx, 5*time.Minute, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := auth.ExtractClaims(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.TenantID != "tenant-1" {
+		t.Errorf("got a token for tenant %q", claims.TenantID)
+	}
+
+	// The exchanged token is cached.
+	if cached, err := ts.IssueToken(ctx, 5*time.Minute, false); err != nil || cached != token {
+		t.Errorf("IssueToken() = %q, %v, want the cached token", cached, err)
+	}
+
+	// A rotated service account token is read again.
+	second := writeServiceAccountToken(t, path, "system:serviceaccount:default:other", "namespace.so")
+
+	if _, err := ts.IssueToken(ctx, 5*time.Minute, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := iam.OIDCTokens(); !reflect.DeepEqual(got, []string{first, second}) {
+		t.Errorf("exchanged %d tokens, want the original and the rotated one", len(got))
+	}
+}
+
+func TestFederationAudience(t *testing.T) {
+	iam, srv := startIAM(t)
+
+	path := filepath.Join(t.TempDir(), "token")
+	writeServiceAccountToken(t, path, "system:serviceaccount:default:builder", "https://kubernetes.default.svc")
+
+	ts := kubernetes.FederationWithOpts("tenant-1", kubernetes.FederationOpts{
+		TokenPath:   path,
+		IAMEndpoint: srv.URL,
+		HTTPClient:  srv.Client(),
+		Audience:    "namespace.so",
+	})
+
+	if _, err := ts.IssueToken(context.Background(), 5*time.Minute, false); err == nil {
+		t.Fatal("a token for another audience was exchanged")
+	}
+
+	if n := iam.Calls("ExchangeOIDCToken"); n != 0 {
+		t.Errorf("%d exchanges, want none", n)
+	}
+}
+
+func TestFederationMissingToken(t *testing.T) {
+	_, srv := startIAM(t)
+
+	ts := kubernetes.FederationWithOpts("tenant-1", kubernetes.FederationOpts{
+		TokenPath:   filepath.Join(t.TempDir(), "missing"),
+		IAMEndpoint: srv.URL,
+		HTTPClient:  srv.Client(),
+	})
+
+	if _, err := ts.IssueToken(context.Background(), 5*time.Minute, false); err == nil {
+		t.Fatal("IssueToken succeeded without a service account token")
+	}
+}
@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// LoadLocalToken returns a TokenSource backed by the token file at path. The
+// parsed token is kept in memory, and reloaded when the file is changed or
+// replaced, allowing the token to be rotated without restarting the process.
+//
+// The file is loaded right away, and an error is returned if it can't be read.
+// On Linux, changes are observed with inotify, and failing to set up the watch
+// is an error; elsewhere, or if the watch later fails, the file is checked for
+// changes on each IssueToken call.
+//
+// Each LocalToken holds an inotify descriptor and a goroutine; callers must
+// call Close when they're done with it.
+func LoadLocalToken(path string) (*LocalToken, error) {
+	return loadLocalToken(path, watchFile)
+}
+
+// loadLocalToken is LoadLocalToken with a custom watch; if watch is nil, the
+// file is checked for changes on use.
+func loadLocalToken(path string, watch func(string, func(), func()) (func(), error)) (*LocalToken, error) {
+	t := &LocalToken{path: path, changed: make(chan struct{})}
+
+	if watch != nil {
+		// Held so that a watch failure is only handled after the watch is recorded.
+		t.mu.Lock()
+		stop, err := watch(path, t.invalidate, t.watchFailed)
+		switch {
+		case err == nil:
+			t.stopWatch = stop
+			t.watching = true
+		case !errors.Is(err, errors.ErrUnsupported):
+			t.mu.Unlock()
+			return nil, fmt.Errorf("failed to watch %s: %w", path, err)
+		}
+		t.mu.Unlock()
+	}
+
+	if _, err := t.load(); err != nil {
+		t.Close()
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// LocalToken is a TokenSource which follows changes to a token file.
+type LocalToken struct {
+	path      string
+	stopWatch func()
+
+	mu       sync.Mutex
+	closed   bool
+	watching bool
+	token    *loadedToken
+	stat     os.FileInfo // When not watched, the file the token was loaded from.
+	changed  chan struct{}
+}
+
+func (t *LocalToken) IssueToken(ctx context.Context, minDuration time.Duration, force bool) (string, error) {
+	tok, err := t.load()
+	if err != nil {
+		return "", err
+	}
+
+	return tok.IssueToken(ctx, minDuration, force)
+}
+
+// Changed returns a channel which is closed the next time the token file
+// changes. Long-lived users, such as connections authenticated with the
+// token, can use it to react to rotation. When the file isn't watched, changes
+// are only noticed by IssueToken.
+func (t *LocalToken) Changed() <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.changed
+}
+
+// Close stops following changes to the token file, and releases the
+// connections of the loaded token.
+func (t *LocalToken) Close() error {
+	if t.stopWatch != nil {
+		t.stopWatch()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.closed = true
+	if t.token != nil {
+		t.token.close()
+		t.token = nil
+	}
+
+	return nil
+}
+
+func (t *LocalToken) load() (*loadedToken, error) {
+	t.mu.Lock()
+	watching := t.watching
+	t.mu.Unlock()
+
+	if !watching {
+		// Without a watch, notice changes by comparing the file's metadata.
+		st, err := os.Stat(t.path)
+		if err != nil {
+			return nil, err
+		}
+
+		t.mu.Lock()
+		if t.stat != nil && !sameFile(t.stat, st) {
+			t.invalidateLocked()
+		}
+		t.stat = st
+		t.mu.Unlock()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil, errors.New("local token is closed")
+	}
+
+	if t.token != nil {
+		return t.token, nil
+	}
+
+	tok, err := loadTokenFile(t.path)
+	if err != nil {
+		return nil, err
+	}
+
+	t.token = tok
+	return tok, nil
+}
+
+func (t *LocalToken) invalidate() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.invalidateLocked()
+}
+
+// watchFailed falls back to checking the file for changes, as the watch can no
+// longer be relied on.
+func (t *LocalToken) watchFailed() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.watching = false
+	t.stat = nil
+	t.invalidateLocked()
+}
+
+func (t *LocalToken) invalidateLocked() {
+	if t.token != nil {
+		t.token.close()
+		t.token = nil
+	}
+
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+func sameFile(a, b os.FileInfo) bool {
+	return os.SameFile(a, b) && a.ModTime().Equal(b.ModTime()) && a.Size() == b.Size()
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// watchFile calls onChange whenever path is written to, replaced, or removed.
+// The directory is watched, rather than the file itself, so that atomic
+// replacements (rename over, or Kubernetes-style symlink swaps) are seen. If
+// the watch fails, onFailure is called and no further changes are reported.
+func watchFile(path string, onChange, onFailure func()) (func(), error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, name := filepath.Split(filepath.Clean(path))
+	if dir == "" {
+		dir = "."
+	}
+
+	if _, err := unix.InotifyAddWatch(fd, dir, unix.IN_CLOSE_WRITE|unix.IN_MODIFY|unix.IN_CREATE|unix.IN_DELETE|unix.IN_MOVED_FROM|unix.IN_MOVED_TO|unix.IN_ATTRIB); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	// A non-blocking descriptor is handled by the runtime poller, so that
+	// closing it interrupts the pending read.
+	f := os.NewFile(uintptr(fd), "inotify")
+
+	last, _ := os.Stat(path)
+
+	go func() {
+		var buf [64 * (unix.SizeofInotifyEvent + unix.NAME_MAX + 1)]byte
+
+		for {
+			n, err := f.Read(buf[:])
+			if err != nil {
+				if !errors.Is(err, os.ErrClosed) {
+					f.Close()
+					onFailure()
+				}
+
+				return
+			}
+
+			changed, other := false, false
+			for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+				ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+				nameBytes := buf[offset+unix.SizeofInotifyEvent : offset+unix.SizeofInotifyEvent+int(ev.Len)]
+				offset += unix.SizeofInotifyEvent + int(ev.Len)
+
+				if cString(nameBytes) == name || ev.Mask&unix.IN_Q_OVERFLOW != 0 {
+					changed = true
+				} else {
+					other = true
+				}
+			}
+
+			// Changes to other entries (e.g. the ..data symlink of Kubernetes
+			// projected volumes) only matter if path now resolves elsewhere.
+			st, _ := os.Stat(path)
+			if other && !changed {
+				changed = (st == nil) != (last == nil) || (st != nil && !sameFile(st, last))
+			}
+
+			last = st
+
+			if changed {
+				onChange()
+			}
+		}
+	}()
+
+	return func() { f.Close() }, nil
+}
+
+func cString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+
+	return string(b)
+}
@@ -0,0 +1,41 @@
+package auth_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"namespacelabs.dev/integrations/auth"
+)
+
+func TestLocalTokenWatched(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.json")
+	writeBearerToken(t, path, "first")
+
+	lt, err := auth.LoadLocalToken(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer lt.Close()
+
+	if got := issueLocal(t, lt); got != "first" {
+		t.Fatalf("got %q", got)
+	}
+
+	for _, token := range []string{"second", "third"} {
+		changed := lt.Changed()
+		writeBearerToken(t, path, token)
+
+		// The change is noticed without the token being used.
+		select {
+		case <-changed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Changed() wasn't closed after the file was replaced")
+		}
+
+		if got := issueLocal(t, lt); got != token {
+			t.Errorf("got %q, want %q", got, token)
+		}
+	}
+}
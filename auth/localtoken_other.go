@@ -0,0 +1,14 @@
+//go:build !linux
+
+package auth
+
+import (
+	"errors"
+	"fmt"
+)
+
+// watchFile is not supported outside of Linux; LocalToken falls back to
+// checking the file on use.
+func watchFile(path string, onChange, onFailure func()) (func(), error) {
+	return nil, fmt.Errorf("file watching is not supported on this platform: %w", errors.ErrUnsupported)
+}
@@ -0,0 +1,118 @@
+package auth_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"namespacelabs.dev/integrations/auth"
+)
+
+// writeBearerToken replaces the token file at path, as a rotation would.
+func writeBearerToken(t *testing.T, path, token string) {
+	t.Helper()
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(`{"bearer_token":"`+token+`"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func issueLocal(t *testing.T, lt *auth.LocalToken) string {
+	t.Helper()
+
+	token, err := lt.IssueToken(context.Background(), time.Minute, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestLocalTokenPolled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.json")
+	writeBearerToken(t, path, "first")
+
+	lt, err := auth.LoadPolledLocalToken(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer lt.Close()
+
+	if got := issueLocal(t, lt); got != "first" {
+		t.Fatalf("got %q", got)
+	}
+
+	changed := lt.Changed()
+	writeBearerToken(t, path, "second")
+
+	// Without a watch, the change is only noticed on use.
+	if isClosed(changed) {
+		t.Error("Changed() was closed before the token was used")
+	}
+
+	if got := issueLocal(t, lt); got != "second" {
+		t.Errorf("got %q, want the rewritten token", got)
+	}
+
+	if !isClosed(changed) {
+		t.Error("Changed() wasn't closed after the token was reloaded")
+	}
+
+	// An unchanged file is not reloaded.
+	changed = lt.Changed()
+	if got := issueLocal(t, lt); got != "second" || isClosed(changed) {
+		t.Errorf("got %q, changed: %v", got, isClosed(changed))
+	}
+}
+
+func TestLoadLocalTokenErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := auth.LoadLocalToken(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("loading a missing file succeeded")
+	}
+
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalid, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := auth.LoadLocalToken(invalid); err == nil {
+		t.Error("loading an invalid file succeeded")
+	}
+}
+
+func TestLocalTokenClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.json")
+	writeBearerToken(t, path, "first")
+
+	lt, err := auth.LoadLocalToken(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lt.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := lt.IssueToken(context.Background(), time.Minute, false); err == nil {
+		t.Error("IssueToken succeeded after Close")
+	}
+}
@@ -0,0 +1,185 @@
+// Package login signs users in to Namespace with a device authorization flow,
+// leaving behind the same token.json that `nsc login` produces.
+package login
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"namespacelabs.dev/integrations/api"
+	"namespacelabs.dev/integrations/auth"
+	"namespacelabs.dev/integrations/internal/fsutil"
+	"namespacelabs.dev/integrations/nsc/apienv"
+	"namespacelabs.dev/integrations/nsc/jsonapi"
+	"namespacelabs.dev/integrations/nsc/profile"
+)
+
+const (
+	startLoginMethod    = "nsl.signin.SigninService/StartLogin"
+	completeLoginMethod = "nsl.signin.SigninService/CompleteTenantLogin"
+
+	defaultPollInterval = 2 * time.Second
+	defaultTimeout      = 10 * time.Minute
+)
+
+type Opts struct {
+	// The endpoint serving the sign-in flow. Defaults to the configured IAM
+	// endpoint.
+	Endpoint string
+
+	// The profile to store credentials in. Defaults to the active profile.
+	Profile string
+
+	// Where the sign-in URL and code are printed. Defaults to os.Stderr.
+	Out io.Writer
+
+	// How often to check whether the sign-in was approved, unless the server
+	// specifies otherwise. Defaults to two seconds.
+	PollInterval time.Duration
+
+	// How long to wait for the sign-in to be approved. Defaults to ten minutes.
+	Timeout time.Duration
+
+	// Used for all requests. Defaults to telemetry.HTTPClient.
+	HTTPClient *http.Client
+}
+
+type startLoginResponse struct {
+	LoginID          string `json:"login_id"`
+	LoginURL         string `json:"login_url"`
+	UserCode         string `json:"user_code"`
+	PollIntervalSecs int64  `json:"poll_interval_secs"`
+}
+
+type completeLoginResponse struct {
+	SessionToken string `json:"session_token"`
+	TenantID     string `json:"tenant_id"`
+}
+
+// Login starts a device authorization flow: it prints a URL, and a code to
+// confirm, for the user to approve the sign-in in a browser. Once approved, the
+// resulting session is stored in the profile's token.json, and returned as a
+// TokenSource.
+//
+// While the sign-in is pending, the server fails CompleteTenantLogin with
+// FailedPrecondition (or DeadlineExceeded, when long-polling).
+func Login(ctx context.Context, opts Opts) (api.TokenSource, error) {
+	if opts.Endpoint == "" {
+		opts.Endpoint = apienv.IAMEndpoint()
+	}
+
+	if opts.Profile == "" {
+		opts.Profile = profile.Active()
+	}
+
+	if opts.Out == nil {
+		opts.Out = os.Stderr
+	}
+
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaultPollInterval
+	}
+
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+
+	dir, err := profile.Dir(opts.Profile)
+	if err != nil {
+		return nil, err
+	}
+
+	var start startLoginResponse
+	if err := jsonapi.Call(ctx, opts.HTTPClient, opts.Endpoint, startLoginMethod, "", map[string]string{
+		"kind": "tenant",
+	}, &start); err != nil {
+		return nil, fmt.Errorf("failed to start login: %w", err)
+	}
+
+	if start.LoginID == "" || start.LoginURL == "" {
+		return nil, errors.New("login response is missing the login id or url")
+	}
+
+	fmt.Fprintf(opts.Out, "\nTo sign in to Namespace, open the following URL in your browser:\n\n  %s\n\n", start.LoginURL)
+	if start.UserCode != "" {
+		fmt.Fprintf(opts.Out, "And confirm that it shows the code: %s\n\n", start.UserCode)
+	}
+
+	interval := opts.PollInterval
+	if start.PollIntervalSecs > 0 {
+		interval = time.Duration(start.PollIntervalSecs) * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	complete, err := poll(ctx, opts, start.LoginID, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeTokenFile(dir, complete.SessionToken); err != nil {
+		return nil, err
+	}
+
+	if complete.TenantID != "" {
+		fmt.Fprintf(opts.Out, "Signed in to %s.\n", complete.TenantID)
+	}
+
+	return auth.LoadProfileToken(opts.Profile)
+}
+
+func poll(ctx context.Context, opts Opts, loginID string, interval time.Duration) (*completeLoginResponse, error) {
+	for {
+		var resp completeLoginResponse
+		err := jsonapi.Call(ctx, opts.HTTPClient, opts.Endpoint, completeLoginMethod, "", map[string]string{
+			"login_id": loginID,
+		}, &resp)
+		if err == nil {
+			if resp.SessionToken == "" {
+				return nil, errors.New("login response is missing the session token")
+			}
+
+			return &resp, nil
+		}
+
+		var jerr *jsonapi.Error
+		if !errors.As(err, &jerr) || (jerr.Code != codes.FailedPrecondition && jerr.Code != codes.DeadlineExceeded) {
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("sign-in was not approved in time: %w", ctx.Err())
+			}
+
+			return nil, fmt.Errorf("failed to complete login: %w", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("sign-in was not approved in time: %w", ctx.Err())
+		case <-time.After(interval):
+		}
+	}
+}
+
+func writeTokenFile(dir, sessionToken string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	contents, err := json.Marshal(map[string]string{
+		"session_token": sessionToken,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Written atomically, as it may be read concurrently (e.g. by LocalToken).
+	return fsutil.WriteFileAtomic(filepath.Join(dir, "token.json"), contents, 0600)
+}
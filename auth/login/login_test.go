@@ -0,0 +1,216 @@
+package login_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"namespacelabs.dev/integrations/auth/login"
+	"namespacelabs.dev/integrations/nsc/profile"
+)
+
+// fakeSessions serves the sign-in methods. The login is approved after pending
+// polls; if fail is set, polls fail with it instead.
+type fakeSessions struct {
+	pending int
+	fail    codes.Code
+
+	mu    sync.Mutex
+	polls int
+	kinds []string
+}
+
+func (s *fakeSessions) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/nsl.signin.SigninService/StartLogin":
+		s.kinds = append(s.kinds, req["kind"])
+		writeJSON(w, map[string]any{
+			"login_id":  "login-1",
+			"login_url": "https://cloud.namespace.so/login/device",
+			"user_code": "ABCD-1234",
+		})
+
+	case "/nsl.signin.SigninService/CompleteTenantLogin":
+		if req["login_id"] != "login-1" {
+			writeStatus(w, codes.NotFound, "unknown login")
+			return
+		}
+
+		s.polls++
+		switch {
+		case s.fail != codes.OK:
+			writeStatus(w, s.fail, "login was rejected")
+		case s.pending < 0 || s.polls <= s.pending:
+			writeStatus(w, codes.FailedPrecondition, "login is pending")
+		default:
+			writeJSON(w, map[string]any{
+				"session_token": "st_session",
+				"tenant_id":     "tenant-1",
+			})
+		}
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeStatus(w http.ResponseWriter, code codes.Code, msg string) {
+	w.Header().Set("grpc-status", strconv.Itoa(int(code)))
+	w.Header().Set("grpc-message", msg)
+	w.WriteHeader(http.StatusBadRequest)
+}
+
+func setup(t *testing.T, s *fakeSessions) (login.Opts, *bytes.Buffer) {
+	t.Helper()
+
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("NSC_PROFILE", "")
+	t.Setenv("NSC_IAM_ENDPOINT", "")
+
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+
+	var out bytes.Buffer
+	return login.Opts{
+		Endpoint:     srv.URL,
+		Out:          &out,
+		PollInterval: time.Millisecond,
+		HTTPClient:   srv.Client(),
+	}, &out
+}
+
+func readTokenFile(t *testing.T, name string) map[string]string {
+	t.Helper()
+
+	dir, err := profile.Dir(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "token.json")
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fi, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if fi.Mode().Perm() != 0600 {
+		t.Errorf("token.json has mode %v, want 0600", fi.Mode().Perm())
+	}
+
+	var tj map[string]string
+	if err := json.Unmarshal(contents, &tj); err != nil {
+		t.Fatal(err)
+	}
+
+	return tj
+}
+
+func TestLogin(t *testing.T) {
+	s := &fakeSessions{pending: 2}
+	opts, out := setup(t, s)
+
+	token, err := login.Login(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token == nil {
+		t.Fatal("no token source returned")
+	}
+
+	if got := readTokenFile(t, profile.Default)["session_token"]; got != "st_session" {
+		t.Errorf("session_token = %q", got)
+	}
+
+	if s.polls != 3 {
+		t.Errorf("polled %d times, want 3", s.polls)
+	}
+
+	if len(s.kinds) != 1 || s.kinds[0] != "tenant" {
+		t.Errorf("started logins of kinds %v", s.kinds)
+	}
+
+	for _, want := range []string{"https://cloud.namespace.so/login/device", "ABCD-1234", "Signed in to tenant-1."} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output doesn't contain %q:\n%s", want, out.String())
+		}
+	}
+
+	// Only the token file is left behind.
+	dir, _ := profile.Dir(profile.Default)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 || entries[0].Name() != "token.json" {
+		t.Errorf("unexpected files in %s: %v", dir, entries)
+	}
+}
+
+func TestLoginProfile(t *testing.T) {
+	opts, _ := setup(t, &fakeSessions{})
+	opts.Profile = "staging"
+
+	if _, err := login.Login(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readTokenFile(t, "staging")["session_token"]; got != "st_session" {
+		t.Errorf("session_token = %q", got)
+	}
+
+	dir, _ := profile.Dir(profile.Default)
+	if _, err := os.Stat(filepath.Join(dir, "token.json")); !os.IsNotExist(err) {
+		t.Errorf("the default profile's token.json was written: %v", err)
+	}
+}
+
+func TestLoginRejected(t *testing.T) {
+	opts, _ := setup(t, &fakeSessions{fail: codes.PermissionDenied})
+
+	if _, err := login.Login(context.Background(), opts); err == nil {
+		t.Fatal("login succeeded")
+	}
+
+	dir, _ := profile.Dir(profile.Default)
+	if _, err := os.Stat(filepath.Join(dir, "token.json")); !os.IsNotExist(err) {
+		t.Errorf("token.json was written: %v", err)
+	}
+}
+
+func TestLoginTimeout(t *testing.T) {
+	opts, _ := setup(t, &fakeSessions{pending: -1})
+	opts.Timeout = 50 * time.Millisecond
+
+	if _, err := login.Login(context.Background(), opts); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,138 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ClientOpts struct {
+	// The server's endpoint: a host:port, or a unix socket path prefixed with
+	// "unix:". Defaults to $NSC_METADATA_ENDPOINT.
+	Endpoint string
+
+	// Sent in the Metadata-Client-Key header, if set.
+	Key string
+
+	// Used for all requests; for unix socket endpoints, a copy with its
+	// transport replaced is used. Defaults to a client which times out after
+	// 30 seconds.
+	HTTPClient *http.Client
+}
+
+const defaultClientTimeout = 30 * time.Second
+
+// TokenSource obtains tokens from a metadata server.
+type TokenSource struct {
+	key    string
+	base   string
+	client *http.Client
+}
+
+func NewTokenSource(opts ClientOpts) (*TokenSource, error) {
+	if opts.Endpoint == "" {
+		opts.Endpoint = os.Getenv(EndpointEnv)
+	}
+
+	if opts.Endpoint == "" {
+		return nil, fmt.Errorf("no metadata server endpoint (%s is not set)", EndpointEnv)
+	}
+
+	client := opts.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: defaultClientTimeout}
+	}
+
+	ts := &TokenSource{key: opts.Key, base: "http://" + opts.Endpoint, client: client}
+
+	if path, ok := strings.CutPrefix(opts.Endpoint, "unix:"); ok {
+		copied := *client
+		ts.base = "http://metadata"
+		ts.client = &copied
+		ts.client.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		}
+	}
+
+	return ts, nil
+}
+
+func (ts *TokenSource) IssueToken(ctx context.Context, minDuration time.Duration, force bool) (string, error) {
+	q := url.Values{}
+	q.Set("min_duration_secs", strconv.FormatInt(int64(minDuration.Seconds()), 10))
+	if force {
+		q.Set("force", "true")
+	}
+
+	var resp tokenResponse
+	if err := ts.get(ctx, tokenPath, q, func(body io.Reader) error {
+		return json.NewDecoder(body).Decode(&resp)
+	}); err != nil {
+		return "", err
+	}
+
+	if resp.AccessToken == "" {
+		return "", errors.New("access_token was missing")
+	}
+
+	return resp.AccessToken, nil
+}
+
+// IDToken returns an OIDC ID token for audience.
+func (ts *TokenSource) IDToken(ctx context.Context, audience string) (string, error) {
+	q := url.Values{}
+	q.Set("audience", audience)
+
+	var token string
+	if err := ts.get(ctx, identityPath, q, func(body io.Reader) error {
+		b, err := io.ReadAll(body)
+		token = strings.TrimSpace(string(b))
+		return err
+	}); err != nil {
+		return "", err
+	}
+
+	if token == "" {
+		return "", errors.New("ID token was missing")
+	}
+
+	return token, nil
+}
+
+func (ts *TokenSource) get(ctx context.Context, path string, q url.Values, read func(io.Reader) error) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", ts.base+path+"?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set(FlavorHeader, Flavor)
+	if ts.key != "" {
+		req.Header.Set(ClientKeyHeader, ts.key)
+	}
+
+	resp, err := ts.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("metadata server failed with status %v: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	return read(resp.Body)
+}
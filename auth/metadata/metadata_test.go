@@ -0,0 +1,178 @@
+package metadata_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"namespacelabs.dev/integrations/auth/authtest"
+	"namespacelabs.dev/integrations/auth/metadata"
+)
+
+const tenantToken = "tenant-token"
+
+// fakeIAM issues ID tokens named after their audience.
+func fakeIAM(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/nsl.tenants.TenantsService/IssueIdToken" || r.Header.Get("Authorization") != "Bearer "+tenantToken {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+
+		var req struct {
+			Audience string `json:"audience"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": "id-token-for-" + req.Audience})
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func startServer(t *testing.T, clients ...metadata.Client) *httptest.Server {
+	t.Helper()
+
+	iam := fakeIAM(t)
+	srv := httptest.NewServer(metadata.NewServer(authtest.StaticTokenSource(tenantToken), metadata.ServerOpts{
+		Clients:     clients,
+		IAMEndpoint: iam.URL,
+		HTTPClient:  iam.Client(),
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func newTokenSource(t *testing.T, srv *httptest.Server, key string) *metadata.TokenSource {
+	t.Helper()
+
+	ts, err := metadata.NewTokenSource(metadata.ClientOpts{
+		Endpoint:   srv.Listener.Addr().String(),
+		Key:        key,
+		HTTPClient: srv.Client(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ts
+}
+
+func TestTokenAndIdentity(t *testing.T) {
+	ts := newTokenSource(t, startServer(t), "")
+	ctx := context.Background()
+
+	if token, err := ts.IssueToken(ctx, time.Minute, false); err != nil || token != tenantToken {
+		t.Errorf("IssueToken() = %q, %v", token, err)
+	}
+
+	if token, err := ts.IDToken(ctx, "https://example.com"); err != nil || token != "id-token-for-https://example.com" {
+		t.Errorf("IDToken() = %q, %v", token, err)
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	endpoint := "unix:" + filepath.Join(t.TempDir(), "metadata.sock")
+
+	lis, err := metadata.Listen(endpoint, metadata.ListenOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &http.Server{Handler: metadata.NewServer(authtest.StaticTokenSource(tenantToken), metadata.ServerOpts{})}
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(func() { srv.Close() })
+
+	ts, err := metadata.NewTokenSource(metadata.ClientOpts{Endpoint: endpoint})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token, err := ts.IssueToken(context.Background(), time.Minute, false); err != nil || token != tenantToken {
+		t.Errorf("IssueToken() = %q, %v", token, err)
+	}
+}
+
+func TestRefusedRequests(t *testing.T) {
+	srv := startServer(t)
+
+	for _, tc := range []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{"missing flavor", nil, "missing Metadata-Flavor"},
+		{"wrong flavor", map[string]string{metadata.FlavorHeader: "Google"}, "missing Metadata-Flavor"},
+		{"forwarded", map[string]string{metadata.FlavorHeader: metadata.Flavor, "X-Forwarded-For": "10.0.0.1"}, "forwarded requests"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", srv.URL+"/computeMetadata/v1/instance/service-accounts/default/token", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+
+			if resp.StatusCode != http.StatusForbidden || !strings.Contains(string(body), tc.want) {
+				t.Errorf("got %v: %s, want %v: %s", resp.Status, body, http.StatusForbidden, tc.want)
+			}
+		})
+	}
+}
+
+func TestClients(t *testing.T) {
+	srv := startServer(t,
+		metadata.Client{Name: "full", Key: "full-key"},
+		metadata.Client{Name: "restricted", Key: "restricted-key", Audiences: []string{"allowed"}},
+	)
+	ctx := context.Background()
+
+	if _, err := newTokenSource(t, srv, "").IssueToken(ctx, time.Minute, false); err == nil {
+		t.Error("a client without a key obtained a token")
+	}
+
+	if _, err := newTokenSource(t, srv, "unknown-key").IssueToken(ctx, time.Minute, false); err == nil {
+		t.Error("a client with an unknown key obtained a token")
+	}
+
+	if token, err := newTokenSource(t, srv, "full-key").IssueToken(ctx, time.Minute, false); err != nil || token != tenantToken {
+		t.Errorf("IssueToken() = %q, %v", token, err)
+	}
+
+	restricted := newTokenSource(t, srv, "restricted-key")
+	if _, err := restricted.IssueToken(ctx, time.Minute, false); err == nil {
+		t.Error("a client restricted to audiences obtained the access token")
+	}
+
+	if token, err := restricted.IDToken(ctx, "allowed"); err != nil || token != "id-token-for-allowed" {
+		t.Errorf("IDToken(allowed) = %q, %v", token, err)
+	}
+
+	if _, err := restricted.IDToken(ctx, "other"); err == nil {
+		t.Error("a restricted client obtained an ID token for another audience")
+	}
+}
@@ -0,0 +1,310 @@
+// Package metadata serves Namespace tokens to local processes over HTTP, on a
+// loopback address or a unix socket, with a protocol modeled after the GCE
+// metadata server. It allows processes which can't read the workload token
+// file (e.g. containers without the mount, or tools written in other
+// languages) to authenticate.
+//
+// Requests must carry the "Metadata-Flavor: Namespace" header, and must not
+// carry X-Forwarded-For, so that the server can't be reached through a
+// misconfigured proxy. Two paths are served:
+//
+//	GET /computeMetadata/v1/instance/service-accounts/default/token
+//	    ?min_duration_secs=<n>&force=<bool>
+//	  => {"access_token": "...", "expires_in": <secs>, "token_type": "Bearer"}
+//
+//	GET /computeMetadata/v1/instance/service-accounts/default/identity
+//	    ?audience=<aud>
+//	  => an OIDC ID token for the audience, as text.
+package metadata
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"namespacelabs.dev/integrations/api"
+	"namespacelabs.dev/integrations/auth"
+	"namespacelabs.dev/integrations/nsc/apienv"
+	"namespacelabs.dev/integrations/nsc/jsonapi"
+	"namespacelabs.dev/integrations/nsc/logging"
+)
+
+const (
+	// EndpointEnv is set by the metadata server command for the processes it
+	// starts, and used by NewTokenSource by default.
+	EndpointEnv = "NSC_METADATA_ENDPOINT"
+
+	FlavorHeader    = "Metadata-Flavor"
+	Flavor          = "Namespace"
+	ClientKeyHeader = "Metadata-Client-Key"
+
+	tokenPath    = "/computeMetadata/v1/instance/service-accounts/default/token"
+	identityPath = "/computeMetadata/v1/instance/service-accounts/default/identity"
+
+	defaultMinDuration = 5 * time.Minute
+)
+
+// Client is a caller of the metadata server, identified by the key it sends in
+// the Metadata-Client-Key header.
+type Client struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+
+	// The audiences this client may obtain ID tokens for. A client restricted
+	// to audiences can't obtain the access token, as it is not scoped. If
+	// empty, the client may obtain the access token and any ID token.
+	Audiences []string `json:"audiences,omitempty"`
+}
+
+type ServerOpts struct {
+	// If set, only these clients are served. Otherwise any local process is.
+	Clients []Client
+
+	// Where ID tokens are issued. Defaults to the configured IAM endpoint.
+	IAMEndpoint string
+
+	// Used to issue ID tokens. Defaults to telemetry.HTTPClient.
+	HTTPClient *http.Client
+
+	// If set, served tokens are logged at info level, and refused or failed
+	// requests at warning level.
+	Logger *slog.Logger
+}
+
+// Server is an http.Handler which serves the tokens of a TokenSource.
+type Server struct {
+	source api.TokenSource
+	opts   ServerOpts
+}
+
+func NewServer(source api.TokenSource, opts ServerOpts) *Server {
+	if opts.IAMEndpoint == "" {
+		opts.IAMEndpoint = apienv.IAMEndpoint()
+	}
+
+	return &Server{source: source, opts: opts}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	client, status, err := s.authorize(r)
+	if err != nil {
+		s.log().WarnContext(r.Context(), "Refused request", "method", r.Method, "path", r.URL.Path, "error", err)
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set(FlavorHeader, Flavor)
+
+	switch r.URL.Path {
+	case tokenPath:
+		s.serveToken(w, r, client)
+
+	case identityPath:
+		s.serveIdentity(w, r, client)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) authorize(r *http.Request) (*Client, int, error) {
+	if r.Method != http.MethodGet {
+		return nil, http.StatusMethodNotAllowed, errors.New("method not allowed")
+	}
+
+	if r.Header.Get(FlavorHeader) != Flavor {
+		return nil, http.StatusForbidden, fmt.Errorf("missing %s: %s header", FlavorHeader, Flavor)
+	}
+
+	if r.Header.Get("X-Forwarded-For") != "" {
+		return nil, http.StatusForbidden, errors.New("forwarded requests are not served")
+	}
+
+	if len(s.opts.Clients) == 0 {
+		return nil, 0, nil
+	}
+
+	key := r.Header.Get(ClientKeyHeader)
+	if key == "" {
+		return nil, http.StatusUnauthorized, errors.New("unknown client")
+	}
+
+	var client *Client
+	for i, c := range s.opts.Clients {
+		// Every key is compared, in constant time, so that timing doesn't
+		// reveal which keys are configured.
+		if subtle.ConstantTimeCompare([]byte(c.Key), []byte(key)) == 1 && client == nil {
+			client = &s.opts.Clients[i]
+		}
+	}
+
+	if client == nil {
+		return nil, http.StatusUnauthorized, errors.New("unknown client")
+	}
+
+	return client, 0, nil
+}
+
+func (s *Server) serveToken(w http.ResponseWriter, r *http.Request, client *Client) {
+	if client != nil && len(client.Audiences) > 0 {
+		s.fail(w, r, client, http.StatusForbidden, errors.New("client may only obtain ID tokens"))
+		return
+	}
+
+	minDuration := defaultMinDuration
+	if v := r.URL.Query().Get("min_duration_secs"); v != "" {
+		secs, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || secs < 0 {
+			s.fail(w, r, client, http.StatusBadRequest, fmt.Errorf("invalid min_duration_secs %q", v))
+			return
+		}
+
+		minDuration = time.Duration(secs) * time.Second
+	}
+
+	force, _ := strconv.ParseBool(r.URL.Query().Get("force"))
+
+	token, err := s.source.IssueToken(r.Context(), minDuration, force)
+	if err != nil {
+		s.fail(w, r, client, http.StatusBadGateway, err)
+		return
+	}
+
+	resp := tokenResponse{AccessToken: token, TokenType: "Bearer"}
+	if t, err := auth.ParseToken(token); err == nil && !t.Expiry.IsZero() {
+		resp.ExpiresIn = int64(time.Until(t.Expiry).Seconds())
+	}
+
+	s.log().InfoContext(r.Context(), "Issued token", "client", clientName(client))
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Server) serveIdentity(w http.ResponseWriter, r *http.Request, client *Client) {
+	audience := r.URL.Query().Get("audience")
+	if audience == "" {
+		s.fail(w, r, client, http.StatusBadRequest, errors.New("audience is required"))
+		return
+	}
+
+	if client != nil && len(client.Audiences) > 0 && !slices.Contains(client.Audiences, audience) {
+		s.fail(w, r, client, http.StatusForbidden, fmt.Errorf("client may not obtain ID tokens for %q", audience))
+		return
+	}
+
+	token, err := s.source.IssueToken(r.Context(), defaultMinDuration, false)
+	if err != nil {
+		s.fail(w, r, client, http.StatusBadGateway, err)
+		return
+	}
+
+	var resp struct {
+		IDToken string `json:"id_token"`
+	}
+
+	if err := jsonapi.Call(r.Context(), s.opts.HTTPClient, s.opts.IAMEndpoint, "nsl.tenants.TenantsService/IssueIdToken", token, map[string]any{
+		"audience": audience,
+		"version":  1,
+	}, &resp); err != nil {
+		s.fail(w, r, client, http.StatusBadGateway, fmt.Errorf("failed to issue ID token: %w", err))
+		return
+	}
+
+	if resp.IDToken == "" {
+		s.fail(w, r, client, http.StatusBadGateway, errors.New("id_token was missing"))
+		return
+	}
+
+	s.log().InfoContext(r.Context(), "Issued ID token", "client", clientName(client), "audience", audience)
+
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = w.Write([]byte(resp.IDToken))
+}
+
+func (s *Server) fail(w http.ResponseWriter, r *http.Request, client *Client, status int, err error) {
+	s.log().WarnContext(r.Context(), "Request failed", "client", clientName(client), "path", r.URL.Path, "error", err)
+	http.Error(w, err.Error(), status)
+}
+
+func (s *Server) log() *slog.Logger {
+	return logging.OrDiscard(s.opts.Logger)
+}
+
+func clientName(c *Client) string {
+	if c == nil {
+		return "anonymous"
+	}
+
+	return c.Name
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in,omitempty"`
+	TokenType   string `json:"token_type"`
+}
+
+type ListenOpts struct {
+	// If set, addresses other than loopback ones are accepted. Any peer which
+	// can reach the address can then obtain tokens, unless Clients are set.
+	AllowNonLoopback bool
+}
+
+// Listen listens on endpoint, which is either a host:port, or a unix socket
+// path prefixed with "unix:". Unix sockets are only accessible to the user.
+// Unless allowed by opts, the host must be a loopback address or "localhost".
+func Listen(endpoint string, opts ListenOpts) (net.Listener, error) {
+	path, ok := strings.CutPrefix(endpoint, "unix:")
+	if !ok {
+		if !opts.AllowNonLoopback {
+			if err := checkLoopback(endpoint); err != nil {
+				return nil, err
+			}
+		}
+
+		return net.Listen("tcp", endpoint)
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, 0600); err != nil {
+		lis.Close()
+		return nil, err
+	}
+
+	return lis, nil
+}
+
+func checkLoopback(endpoint string) error {
+	host, _, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return err
+	}
+
+	if host == "localhost" {
+		return nil
+	}
+
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+
+	return fmt.Errorf("%q is not a loopback address; the metadata server only serves local processes", endpoint)
+}
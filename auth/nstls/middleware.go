@@ -0,0 +1,93 @@
+package nstls
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor authenticates callers by their client certificate,
+// and makes their Identity available to handlers. The server must terminate
+// TLS itself, with a configuration such as the one returned by ServerConfig.
+func UnaryServerInterceptor(opts ServerOpts) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := opts.authenticateGRPC(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is the streaming counterpart of UnaryServerInterceptor.
+func StreamServerInterceptor(opts ServerOpts) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := opts.authenticateGRPC(ss.Context())
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &identityStream{ss, ctx})
+	}
+}
+
+// Middleware authenticates callers of next by their client certificate, and
+// makes their Identity available through the request's context.
+func Middleware(opts ServerOpts, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil {
+			http.Error(w, "client certificate required", http.StatusUnauthorized)
+			return
+		}
+
+		id, err := opts.authorize(*r.TLS)
+		if err != nil {
+			if errors.Is(err, ErrNotAllowed) {
+				http.Error(w, err.Error(), http.StatusForbidden)
+			} else {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+			}
+
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), id)))
+	})
+}
+
+func (opts ServerOpts) authenticateGRPC(ctx context.Context) (context.Context, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "no peer information")
+	}
+
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "client certificate required")
+	}
+
+	id, err := opts.authorize(info.State)
+	if err != nil {
+		if errors.Is(err, ErrNotAllowed) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	return WithIdentity(ctx, id), nil
+}
+
+type identityStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *identityStream) Context() context.Context { return s.ctx }
@@ -0,0 +1,123 @@
+package nstls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Identity is the caller authenticated by a Namespace-issued client
+// certificate.
+type Identity struct {
+	TenantID string
+	// The actor the certificate was issued to within the tenant (e.g. a user
+	// or a workload), if the certificate names one.
+	Actor string
+
+	Certificate *x509.Certificate
+}
+
+type ServerOpts struct {
+	// The Namespace tenant CAs that client certificates must chain to.
+	// Required.
+	ClientCAs *x509.CertPool
+
+	// The server's own certificates; see tls.Config.
+	Certificates   []tls.Certificate
+	GetCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+
+	// Tenants that are allowed to connect, mapped to the actors of each tenant
+	// that are allowed to. A tenant with no actors listed allows all of its
+	// actors. If empty, callers of any tenant are allowed.
+	Allow map[string][]string
+
+	// Determines the caller from its verified certificate. Defaults to
+	// IdentityFromCertificate.
+	Identify func(*x509.Certificate) (Identity, error)
+}
+
+// ServerConfig provides a TLS configuration that requires callers to present a
+// client certificate issued by Namespace, and only accepts those allowed by
+// opts.Allow. Use UnaryServerInterceptor, StreamServerInterceptor or
+// Middleware to obtain the caller's Identity within a request.
+func ServerConfig(opts ServerOpts) (*tls.Config, error) {
+	if opts.ClientCAs == nil {
+		return nil, errors.New("ClientCAs is required")
+	}
+
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		Certificates:   opts.Certificates,
+		GetCertificate: opts.GetCertificate,
+		ClientAuth:     tls.RequireAndVerifyClientCert,
+		ClientCAs:      opts.ClientCAs,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			_, err := opts.authorize(cs)
+			return err
+		},
+	}, nil
+}
+
+// IdentityFromCertificate reads the tenant ID from the certificate's subject
+// common name, and the actor from its first organizational unit.
+func IdentityFromCertificate(cert *x509.Certificate) (Identity, error) {
+	if cert.Subject.CommonName == "" {
+		return Identity{}, errors.New("certificate does not name a tenant")
+	}
+
+	id := Identity{TenantID: cert.Subject.CommonName, Certificate: cert}
+	if len(cert.Subject.OrganizationalUnit) > 0 {
+		id.Actor = cert.Subject.OrganizationalUnit[0]
+	}
+
+	return id, nil
+}
+
+// ErrNotAllowed is returned when a verified caller is not in the allow-list.
+var ErrNotAllowed = errors.New("caller is not allowed")
+
+func (opts ServerOpts) authorize(cs tls.ConnectionState) (Identity, error) {
+	if len(cs.VerifiedChains) == 0 || len(cs.VerifiedChains[0]) == 0 {
+		return Identity{}, errors.New("no verified client certificate")
+	}
+
+	identify := opts.Identify
+	if identify == nil {
+		identify = IdentityFromCertificate
+	}
+
+	id, err := identify(cs.VerifiedChains[0][0])
+	if err != nil {
+		return Identity{}, err
+	}
+
+	if len(opts.Allow) > 0 {
+		actors, ok := opts.Allow[id.TenantID]
+		if !ok {
+			return Identity{}, fmt.Errorf("%w: tenant %q", ErrNotAllowed, id.TenantID)
+		}
+
+		if len(actors) > 0 && !slices.Contains(actors, id.Actor) {
+			return Identity{}, fmt.Errorf("%w: actor %q of tenant %q", ErrNotAllowed, id.Actor, id.TenantID)
+		}
+	}
+
+	return id, nil
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a context which carries the caller's identity.
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// IdentityFromContext returns the caller's identity, as set by the server
+// interceptors and Middleware.
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
@@ -10,37 +10,57 @@ import (
 	"namespacelabs.dev/integrations/api/iam"
 )
 
+// TenantTokenSource returns a source of tenant tokens and client certificates,
+// issued by the partner IAM client. Both are cached and refreshed ahead of
+// their expiry.
 func TenantTokenSource(client iam.Client, tenantId string) api.TokenAndCertificateSource {
-	return iamTokenSource{client, tenantId}
+	return newIAMTokenSource(client, tenantId)
 }
 
 func TenantCertificateSource(client iam.Client, tenantId string) api.TokenAndCertificateSource {
-	return iamTokenSource{client, tenantId}
+	return newIAMTokenSource(client, tenantId)
 }
 
 type iamTokenSource struct {
 	client   iam.Client
 	tenantId string
+
+	tokens *refreshingCache[string]
+	certs  api.CertificateSource
+}
+
+func newIAMTokenSource(client iam.Client, tenantId string) *iamTokenSource {
+	ts := &iamTokenSource{client: client, tenantId: tenantId}
+	ts.tokens = newRefreshingCache(ts.issueToken, CacheOpts{})
+	ts.certs = CachedCertificateSource(ts.issueCertificate, CacheOpts{})
+	return ts
 }
 
-func (ts iamTokenSource) IssueToken(ctx context.Context, minDuration time.Duration, force bool) (string, error) {
-	// TODO implement token caching.
+func (ts *iamTokenSource) IssueToken(ctx context.Context, minDuration time.Duration, force bool) (string, error) {
+	return ts.tokens.get(ctx, minDuration, force)
+}
+
+func (ts *iamTokenSource) issueToken(ctx context.Context, dur time.Duration) (string, time.Time, error) {
+	issuedAt := time.Now()
 	token, err := ts.client.Tenants.IssueTenantToken(ctx, &iamv1beta.IssueTenantTokenRequest{
 		TenantId:     ts.tenantId,
-		DurationSecs: int64(minDuration.Seconds()),
+		DurationSecs: int64(dur.Seconds()),
 	})
 	if err != nil {
-		return "", err
+		return "", time.Time{}, err
 	}
 
-	return token.BearerToken, nil
+	return token.BearerToken, tokenExpiry(token.BearerToken, issuedAt, dur), nil
+}
+
+func (ts *iamTokenSource) IssueCertificate(ctx context.Context, minDuration time.Duration, force bool) (tls.Certificate, error) {
+	return ts.certs.IssueCertificate(ctx, minDuration, force)
 }
 
-func (ts iamTokenSource) IssueCertificate(ctx context.Context, minDuration time.Duration, force bool) (tls.Certificate, error) {
-	// TODO implement certificate caching.
+func (ts *iamTokenSource) issueCertificate(ctx context.Context, dur time.Duration) (tls.Certificate, error) {
 	resp, err := ts.client.Tenants.IssueTenantClientCertificate(ctx, &iamv1beta.IssueTenantClientCertificateRequest{
 		TenantId:     ts.tenantId,
-		DurationSecs: int64(minDuration.Seconds()),
+		DurationSecs: int64(dur.Seconds()),
 	})
 	if err != nil {
 		return tls.Certificate{}, err
@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	iamv1beta "buf.build/gen/go/namespace/cloud/protocolbuffers/go/proto/namespace/cloud/iam/v1beta"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"namespacelabs.dev/integrations/api"
+	"namespacelabs.dev/integrations/api/iam"
+)
+
+const defaultRestrictedTokenDuration = time.Hour
+
+// Resource types and actions of the grants built by PushToRepository and
+// ReadStorageNamespace.
+const (
+	ResourceTypeRepository       = "registry/repository"
+	ResourceTypeStorageNamespace = "storage/namespace"
+
+	ActionPush = "push"
+	ActionRead = "read"
+)
+
+// Grant permits a set of actions on a single resource.
+type Grant struct {
+	ResourceType string
+	ResourceID   string
+	Actions      []string
+}
+
+// PushToRepository returns a grant which only allows pushing images to
+// repository, in the tenant's nscr.io registry (e.g. "nscr.io/<tenant>/app").
+// A tag or digest, if present, is ignored; the grant covers the repository.
+func PushToRepository(repository string) (Grant, error) {
+	host, path, ok := strings.Cut(repository, "/")
+	if !ok || (host != "nscr.io" && !strings.HasSuffix(host, ".nscr.io")) {
+		return Grant{}, fmt.Errorf("%q is not a nscr.io repository", repository)
+	}
+
+	path, _, _ = strings.Cut(path, "@")
+	if i := strings.LastIndexByte(path, ':'); i > strings.LastIndexByte(path, '/') {
+		path = path[:i]
+	}
+
+	if !strings.Contains(path, "/") || strings.HasSuffix(path, "/") {
+		return Grant{}, fmt.Errorf("%q does not name a repository within a tenant's registry", repository)
+	}
+
+	return Grant{ResourceType: ResourceTypeRepository, ResourceID: path, Actions: []string{ActionPush}}, nil
+}
+
+// ReadStorageNamespace returns a grant which only allows reading the artifacts
+// of a storage namespace.
+func ReadStorageNamespace(namespace string) Grant {
+	return Grant{ResourceType: ResourceTypeStorageNamespace, ResourceID: namespace, Actions: []string{ActionRead}}
+}
+
+type RestrictedTokenOpts struct {
+	// Name and description of the token, as shown when listing tokens.
+	Name        string
+	Description string
+
+	// For how long the token is valid. Defaults to one hour.
+	Duration time.Duration
+
+	// The only permissions the token carries. At least one is required.
+	Grants []Grant
+}
+
+// RestrictedToken is a revokable token which only carries the permissions it
+// was issued with. It is a TokenSource which hands out the same bearer token
+// until it expires; it is never refreshed.
+type RestrictedToken struct {
+	TokenID     string
+	BearerToken string
+	ExpiresAt   time.Time
+}
+
+// IssueRestrictedToken issues a short-lived token, with a narrow set of
+// permissions, using the credentials of parent. The resulting token can be
+// handed to less trusted code, and revoked with RevokeRestrictedToken.
+func IssueRestrictedToken(ctx context.Context, parent api.TokenSource, opts RestrictedTokenOpts) (*RestrictedToken, error) {
+	cli, err := iam.NewClient(ctx, parent)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cli.Close()
+
+	return IssueRestrictedTokenWithClient(ctx, cli, opts)
+}
+
+func IssueRestrictedTokenWithClient(ctx context.Context, cli iam.Client, opts RestrictedTokenOpts) (*RestrictedToken, error) {
+	if len(opts.Grants) == 0 {
+		return nil, errors.New("restricted tokens require at least one grant")
+	}
+
+	dur := opts.Duration
+	if dur <= 0 {
+		dur = defaultRestrictedTokenDuration
+	}
+
+	access := &iamv1beta.AccessPolicy{}
+	for _, g := range opts.Grants {
+		if g.ResourceType == "" || g.ResourceID == "" || len(g.Actions) == 0 {
+			return nil, fmt.Errorf("grant %+v must name a resource type, a resource and actions", g)
+		}
+
+		access.Grants = append(access.Grants, &iamv1beta.Permission{
+			ResourceType: g.ResourceType,
+			ResourceId:   g.ResourceID,
+			Actions:      g.Actions,
+		})
+	}
+
+	expiresAt := time.Now().Add(dur)
+	resp, err := cli.Tokens.CreateRevokableToken(ctx, &iamv1beta.CreateRevokableTokenRequest{
+		Name:        opts.Name,
+		Description: opts.Description,
+		ExpiresAt:   timestamppb.New(expiresAt),
+		Access:      access,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.GetToken().GetExpiresAt() != nil {
+		expiresAt = resp.GetToken().GetExpiresAt().AsTime()
+	}
+
+	return &RestrictedToken{
+		TokenID:     resp.GetToken().GetTokenId(),
+		BearerToken: resp.BearerToken,
+		ExpiresAt:   expiresAt,
+	}, nil
+}
+
+// RevokeRestrictedToken revokes a token issued by IssueRestrictedToken, using
+// the credentials of parent.
+func RevokeRestrictedToken(ctx context.Context, parent api.TokenSource, tokenID string) error {
+	cli, err := iam.NewClient(ctx, parent)
+	if err != nil {
+		return err
+	}
+
+	defer cli.Close()
+
+	return RevokeRestrictedTokenWithClient(ctx, cli, tokenID)
+}
+
+func RevokeRestrictedTokenWithClient(ctx context.Context, cli iam.Client, tokenID string) error {
+	_, err := cli.Tokens.RevokeRevokableToken(ctx, &iamv1beta.RevokeRevokableTokenRequest{
+		TokenId: tokenID,
+	})
+	return err
+}
+
+func (t *RestrictedToken) IssueToken(ctx context.Context, minDuration time.Duration, force bool) (string, error) {
+	if time.Now().Add(minDuration).After(t.ExpiresAt) {
+		return "", fmt.Errorf("restricted token %s expires at %v", t.TokenID, t.ExpiresAt.Format(time.RFC3339))
+	}
+
+	return t.BearerToken, nil
+}
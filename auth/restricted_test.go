@@ -0,0 +1,128 @@
+package auth_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	iamv1beta "buf.build/gen/go/namespace/cloud/protocolbuffers/go/proto/namespace/cloud/iam/v1beta"
+	"namespacelabs.dev/integrations/auth"
+	"namespacelabs.dev/integrations/auth/authtest"
+)
+
+func TestPushToRepository(t *testing.T) {
+	for repository, want := range map[string]string{
+		"nscr.io/tenant/app":                  "tenant/app",
+		"nscr.io/tenant/team/app:v1":          "tenant/team/app",
+		"staging.nscr.io/tenant/app@sha256:0": "tenant/app",
+	} {
+		g, err := auth.PushToRepository(repository)
+		if err != nil {
+			t.Errorf("PushToRepository(%q): %v", repository, err)
+			continue
+		}
+
+		if g.ResourceType != auth.ResourceTypeRepository || g.ResourceID != want || len(g.Actions) != 1 || g.Actions[0] != auth.ActionPush {
+			t.Errorf("PushToRepository(%q) = %+v", repository, g)
+		}
+	}
+
+	for _, repository := range []string{"docker.io/library/app", "nscr.io/tenant", "nscr.io/tenant/", "app"} {
+		if _, err := auth.PushToRepository(repository); err == nil {
+			t.Errorf("PushToRepository(%q) succeeded", repository)
+		}
+	}
+}
+
+func TestIssueRestrictedToken(t *testing.T) {
+	srv, err := authtest.NewIAMServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer srv.Close()
+
+	ctx := context.Background()
+	cli, err := srv.Client(ctx, authtest.StaticTokenSource("parent-token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer cli.Close()
+
+	push, err := auth.PushToRepository("nscr.io/tenant/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tok, err := auth.IssueRestrictedTokenWithClient(ctx, cli, auth.RestrictedTokenOpts{
+		Name:     "build-step",
+		Duration: 10 * time.Minute,
+		Grants:   []auth.Grant{push, auth.ReadStorageNamespace("cache")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issued := srv.RevokableToken(tok.TokenID)
+	if issued == nil {
+		t.Fatalf("IAM has no token %q", tok.TokenID)
+	}
+
+	var got []string
+	for _, p := range issued.GetPermissions() {
+		got = append(got, p.GetResourceType()+":"+p.GetResourceId()+":"+p.GetActions()[0])
+	}
+
+	if len(got) != 2 || got[0] != "registry/repository:tenant/app:push" || got[1] != "storage/namespace:cache:read" {
+		t.Errorf("issued with permissions %v", got)
+	}
+
+	// The token is handed out until it no longer lasts the requested duration.
+	if bearer, err := tok.IssueToken(ctx, 5*time.Minute, false); err != nil || bearer != tok.BearerToken {
+		t.Errorf("IssueToken() = %q, %v", bearer, err)
+	}
+
+	if _, err := tok.IssueToken(ctx, 20*time.Minute, false); err == nil {
+		t.Error("IssueToken succeeded past the token's expiry")
+	}
+
+	if err := auth.RevokeRestrictedTokenWithClient(ctx, cli, tok.TokenID); err != nil {
+		t.Fatal(err)
+	}
+
+	if state := srv.RevokableToken(tok.TokenID).GetState(); state != iamv1beta.RevokableToken_REVOKED {
+		t.Errorf("token is %v after revocation", state)
+	}
+}
+
+func TestIssueRestrictedTokenInvalidGrants(t *testing.T) {
+	srv, err := authtest.NewIAMServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer srv.Close()
+
+	ctx := context.Background()
+	cli, err := srv.Client(ctx, authtest.StaticTokenSource("parent-token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer cli.Close()
+
+	for _, grants := range [][]auth.Grant{
+		nil,
+		{auth.ReadStorageNamespace("")},
+		{{ResourceType: "instance", ResourceID: "inst-1"}},
+	} {
+		if _, err := auth.IssueRestrictedTokenWithClient(ctx, cli, auth.RestrictedTokenOpts{Name: "invalid", Grants: grants}); err == nil {
+			t.Errorf("issued a token with grants %+v", grants)
+		}
+	}
+
+	if n := srv.Calls("CreateRevokableToken"); n != 0 {
+		t.Errorf("%d tokens were created", n)
+	}
+}
@@ -2,9 +2,11 @@ package auth
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"sync"
@@ -12,11 +14,14 @@ import (
 
 	"buf.build/gen/go/namespace/cloud/grpc/go/proto/namespace/private/sessions/sessionsv1betagrpc"
 	sessions "buf.build/gen/go/namespace/cloud/protocolbuffers/go/proto/namespace/private/sessions"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/protobuf/types/known/durationpb"
 	"namespacelabs.dev/integrations/api"
 	"namespacelabs.dev/integrations/nsc/apienv"
 	"namespacelabs.dev/integrations/nsc/grpcapi"
+	"namespacelabs.dev/integrations/nsc/logging"
+	"namespacelabs.dev/integrations/nsc/profile"
 )
 
 type loadedToken struct {
@@ -24,31 +29,60 @@ type loadedToken struct {
 	SessionToken string
 
 	dir      string
-	debugLog io.Writer
+	debugLog *slog.Logger
+	// If set, overrides the IAM endpoint that session tokens are exchanged with.
+	iamEndpoint string
 
 	mu             sync.Mutex
+	closed         bool
+	conn           *grpc.ClientConn
 	sessionsClient sessionsv1betagrpc.UserSessionsServiceClient
+	certs          api.CertificateSource
 }
 
 func (t *loadedToken) client(ctx context.Context) (sessionsv1betagrpc.UserSessionsServiceClient, error) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
+	if t.closed {
+		return nil, errors.New("the token file was reloaded")
+	}
+
 	if t.sessionsClient == nil {
-		conn, err := grpcapi.NewConnectionWithEndpoint(ctx, apienv.IAMEndpoint(), nil)
+		endpoint := t.iamEndpoint
+		if endpoint == "" {
+			endpoint = apienv.IAMEndpoint()
+		}
+
+		conn, err := grpcapi.NewConnectionWithEndpoint(ctx, endpoint, nil)
 		if err != nil {
 			return nil, err
 		}
 
+		t.conn = conn
 		t.sessionsClient = sessionsv1betagrpc.NewUserSessionsServiceClient(conn)
 	}
 
 	return t.sessionsClient, nil
 }
 
+// close closes the connection used to exchange session tokens, if one was
+// opened. Tokens which are still being issued with it fail.
+func (t *loadedToken) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.closed = true
+	if t.conn != nil {
+		t.conn.Close()
+		t.conn = nil
+		t.sessionsClient = nil
+	}
+}
+
 func (t *loadedToken) IssueToken(ctx context.Context, minDur time.Duration, skipCache bool) (string, error) {
 	if t.SessionToken != "" {
-		issue := func(dur time.Duration) (string, error) {
+		issue := func(ctx context.Context, dur time.Duration) (string, error) {
 			cli, err := t.client(ctx)
 			if err != nil {
 				return "", err
@@ -65,7 +99,7 @@ func (t *loadedToken) IssueToken(ctx context.Context, minDur time.Duration, skip
 		}
 
 		if skipCache {
-			return issue(minDur)
+			return issue(ctx, minDur)
 		}
 
 		sessionClaims, err := ExtractClaims(t.SessionToken)
@@ -73,77 +107,81 @@ func (t *loadedToken) IssueToken(ctx context.Context, minDur time.Duration, skip
 			return "", err
 		}
 
-		if t.dir != "" {
-			cachePath := filepath.Join(t.dir, "token.cache")
-			cacheContents, err := os.ReadFile(cachePath)
-			if err != nil {
-				if !os.IsNotExist(err) {
-					return "", err
-				}
-			} else {
-				cacheClaims, err := ExtractClaims(string(cacheContents))
-				if err != nil {
-					return "", err
-				}
-
-				if cacheClaims.TenantID == sessionClaims.TenantID {
-					if cacheClaims.VerifyExpiresAt(time.Now().Add(minDur), true) {
-						return string(cacheContents), nil
-					}
-				}
-			}
-		}
-
 		dur := 2 * minDur
 		if dur > time.Hour {
 			dur = time.Hour
 		}
 
-		newToken, err := issue(dur)
-		if err == nil && t.dir != "" {
-			cachePath := filepath.Join(t.dir, "token.cache")
-			if err := os.WriteFile(cachePath, []byte(newToken), 0600); err != nil {
-				fmt.Fprintf(t.debugLog, "Failed to write token cache: %v\n", err)
-			}
+		if t.dir == "" {
+			return issue(ctx, dur)
 		}
 
-		return newToken, err
+		cache := diskTokenCache{dir: t.dir, debugLog: t.debugLog}
+		return cache.issue(ctx, sessionClaims.TenantID, minDur, func(ctx context.Context) (string, error) {
+			return issue(ctx, dur)
+		})
 	}
 
 	return t.BearerToken, nil
 }
 
-func LoadDefaults() (api.TokenSource, error) {
-	if tf := os.Getenv("NSC_TOKEN_FILE"); tf != "" {
-		return loadFromFile(tf)
-	}
-
-	t, err := loadFromFile("/var/run/nsc/token.json")
-	if err == nil {
-		return t, nil
+// IssueCertificate issues a tenant client certificate, by exchanging the
+// tenant token obtained from the loaded credentials. This allows any default
+// credentials to be used for mTLS to builders and instances.
+func (t *loadedToken) IssueCertificate(ctx context.Context, minDuration time.Duration, force bool) (tls.Certificate, error) {
+	t.mu.Lock()
+	if t.certs == nil {
+		t.certs = newCertificateExchange(t, t.iamEndpoint)
 	}
+	certs := t.certs
+	t.mu.Unlock()
 
-	if !os.IsNotExist(err) {
-		return nil, err
-	}
+	return certs.IssueCertificate(ctx, minDuration, force)
+}
 
-	return LoadUserToken()
+// LoadDefaults loads credentials from the first of the providers in
+// DefaultChain that has them. Use DefaultChain().Resolve() to find out which
+// one was used.
+//
+// Credentials loaded from token files also issue client certificates; use
+// WithCertificates to obtain an api.TokenAndCertificateSource.
+func LoadDefaults() (api.TokenSource, error) {
+	return DefaultChain().Load()
 }
 
+// LoadUserToken loads the token left behind by `nsc login` for the active
+// profile (see profile.Active).
 func LoadUserToken() (api.TokenSource, error) {
-	dir, err := configDir()
+	return LoadProfileToken(profile.Active())
+}
+
+// LoadProfileToken loads the user token of the named profile.
+func LoadProfileToken(name string) (api.TokenSource, error) {
+	path, err := userTokenPath(name)
 	if err != nil {
 		return nil, err
 	}
 
-	token, err := loadFromFile(filepath.Join(dir, "token.json"))
+	token, err := loadTokenFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("you are not logged in to Namespace; try running `nsc login`")
+			if name != "" && name != profile.Default {
+				return nil, noCredentials(fmt.Sprintf("you are not logged in to Namespace in profile %q", name))
+			}
+
+			return nil, noCredentials("you are not logged in to Namespace; try running `nsc login`")
 		}
+
+		return nil, err
 	}
 
-	return token, err
+	// The profile may not be the active one, so its overrides are not
+	// necessarily what apienv resolves.
+	if p, err := profile.Load(name); err == nil && p.IAMEndpoint != "" && os.Getenv("NSC_IAM_ENDPOINT") == "" {
+		token.iamEndpoint = p.IAMEndpoint
+	}
+
+	return token, nil
 }
 
 func LoadWorkloadToken() (api.TokenSource, error) {
@@ -151,30 +189,19 @@ func LoadWorkloadToken() (api.TokenSource, error) {
 		return loadFromFile(tf)
 	}
 
-	return loadFromFile("/var/run/nsc/token.json")
-}
-
-// LoadLocalToken returns a TokenSource that reloads the token from the
-// specified file path on each IssueToken call, allowing the token to be
-// updated without restarting the process.
-func LoadLocalToken(path string) (api.TokenSource, error) {
-	return reloadingToken{path: path}, nil
-}
-
-type reloadingToken struct {
-	path string
+	return loadFromFile(workloadTokenPath)
 }
 
-func (r reloadingToken) IssueToken(ctx context.Context, minDuration time.Duration, force bool) (string, error) {
-	tok, err := loadFromFile(r.path)
+func loadFromFile(tokenFile string) (api.TokenSource, error) {
+	t, err := loadTokenFile(tokenFile)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return tok.IssueToken(ctx, minDuration, force)
+	return t, nil
 }
 
-func loadFromFile(tokenFile string) (api.TokenSource, error) {
+func loadTokenFile(tokenFile string) (*loadedToken, error) {
 	contents, err := os.ReadFile(tokenFile)
 	if err != nil {
 		return nil, err
@@ -193,19 +220,10 @@ func loadFromFile(tokenFile string) (api.TokenSource, error) {
 		BearerToken:  tj.BearerToken,
 		SessionToken: tj.SessionToken,
 		dir:          filepath.Dir(tokenFile),
-		debugLog:     io.Discard,
+		debugLog:     logging.Discard,
 	}, nil
 }
 
-func configDir() (string, error) {
-	dir, err := os.UserConfigDir()
-	if err != nil {
-		return dir, err
-	}
-
-	return filepath.Join(dir, "ns"), nil
-}
-
 func setGrpcBearer(ctx context.Context, bearer string) context.Context {
 	return metadata.AppendToOutgoingContext(ctx, "authorization", fmt.Sprintf("Bearer %s", bearer))
 }
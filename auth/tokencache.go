@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"namespacelabs.dev/integrations/internal/fsutil"
+)
+
+const (
+	// Not "token.cache", which the nsc CLI and older versions of the SDK use
+	// to cache a single raw token.
+	tokenCacheName     = "token-cache.v1.json"
+	tokenCacheLockName = "token-cache.v1.json.lock"
+	tokenCacheVersion  = 1
+
+	maxTokenCacheEntries = 8
+)
+
+// diskTokenCache keeps tenant tokens issued from a session next to the token
+// file, so they can be shared across processes. Access is serialized with an
+// advisory file lock, which is held while a new token is issued: processes
+// which miss the cache concurrently wait for the first one's token, rather than
+// each issuing their own.
+type diskTokenCache struct {
+	dir      string
+	debugLog *slog.Logger
+}
+
+type tokenCacheContents struct {
+	Version int               `json:"version"`
+	Entries []json.RawMessage `json:"entries"`
+}
+
+type tokenCacheEntry struct {
+	TenantID  string    `json:"tenant_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Token     string    `json:"token"`
+}
+
+// issue returns a cached token for tenantID that is valid for at least
+// minDur, or calls issue and caches its result. Waiting for the lock, and
+// issuance while it's held, are bounded by ctx.
+func (c diskTokenCache) issue(ctx context.Context, tenantID string, minDur time.Duration, issue func(context.Context) (string, error)) (string, error) {
+	unlock, err := lockFile(ctx, filepath.Join(c.dir, tokenCacheLockName))
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+
+		c.debugLog.Debug("Failed to lock token cache", "error", err)
+		return issue(ctx)
+	}
+
+	defer unlock()
+
+	entries := c.load()
+	if token, ok := lookup(entries, tenantID, minDur); ok {
+		return token, nil
+	}
+
+	// Other processes wait for the lock, so don't hold it indefinitely.
+	issueCtx, cancel := context.WithTimeout(ctx, issueTimeout)
+	defer cancel()
+
+	token, err := issue(issueCtx)
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := ExtractClaims(token)
+	if err != nil || claims.ExpiresAt == nil {
+		c.debugLog.Debug("Not caching token without a parseable expiry")
+		return token, nil
+	}
+
+	entries = append(entries, tokenCacheEntry{
+		TenantID:  claims.TenantID,
+		ExpiresAt: claims.ExpiresAt.Time,
+		Token:     token,
+	})
+
+	if err := c.store(entries); err != nil {
+		c.debugLog.Debug("Failed to write token cache", "error", err)
+	}
+
+	return token, nil
+}
+
+// lookup returns the token for tenantID in entries which is valid for at least
+// minDur and expires last, if any.
+func lookup(entries []tokenCacheEntry, tenantID string, minDur time.Duration) (string, bool) {
+	deadline := time.Now().Add(minDur)
+	var best *tokenCacheEntry
+	for k, e := range entries {
+		if e.TenantID == tenantID && e.ExpiresAt.After(deadline) {
+			if best == nil || e.ExpiresAt.After(best.ExpiresAt) {
+				best = &entries[k]
+			}
+		}
+	}
+
+	if best == nil {
+		return "", false
+	}
+
+	return best.Token, true
+}
+
+// load returns the valid entries in the cache. Entries that can't be parsed,
+// or whose token doesn't match the entry, are discarded.
+func (c diskTokenCache) load() []tokenCacheEntry {
+	contents, err := os.ReadFile(filepath.Join(c.dir, tokenCacheName))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			c.debugLog.Debug("Failed to read token cache", "error", err)
+		}
+
+		return nil
+	}
+
+	var cache tokenCacheContents
+	if err := json.Unmarshal(contents, &cache); err != nil || cache.Version != tokenCacheVersion {
+		c.debugLog.Debug("Discarding unrecognized token cache")
+		return nil
+	}
+
+	var entries []tokenCacheEntry
+	for _, raw := range cache.Entries {
+		var e tokenCacheEntry
+		if err := json.Unmarshal(raw, &e); err != nil {
+			continue
+		}
+
+		claims, err := ExtractClaims(e.Token)
+		if err != nil || claims.TenantID != e.TenantID {
+			continue
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries
+}
+
+// store atomically replaces the cache with the entries that have not yet
+// expired, keeping those that expire last.
+func (c diskTokenCache) store(entries []tokenCacheEntry) error {
+	now := time.Now()
+
+	var live []tokenCacheEntry
+	for _, e := range entries {
+		if e.ExpiresAt.After(now) {
+			live = append(live, e)
+		}
+	}
+
+	sort.Slice(live, func(i, j int) bool {
+		return live[i].ExpiresAt.After(live[j].ExpiresAt)
+	})
+
+	if len(live) > maxTokenCacheEntries {
+		live = live[:maxTokenCacheEntries]
+	}
+
+	cache := tokenCacheContents{Version: tokenCacheVersion}
+	for _, e := range live {
+		raw, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+
+		cache.Entries = append(cache.Entries, raw)
+	}
+
+	contents, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+
+	return fsutil.WriteFileAtomic(filepath.Join(c.dir, tokenCacheName), contents, 0600)
+}
@@ -0,0 +1,235 @@
+package auth_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"namespacelabs.dev/integrations/auth"
+	"namespacelabs.dev/integrations/auth/authtest"
+)
+
+// countingIssuer mints tenant tokens which expire after lifetime, and counts
+// them.
+type countingIssuer struct {
+	signer   *authtest.Signer
+	tenantID string
+	lifetime time.Duration
+	issued   atomic.Int32
+}
+
+func newCountingIssuer(signer *authtest.Signer, tenantID string, lifetime time.Duration) *countingIssuer {
+	return &countingIssuer{signer: signer, tenantID: tenantID, lifetime: lifetime}
+}
+
+func (i *countingIssuer) issue(context.Context) (string, error) {
+	i.issued.Add(1)
+	return i.signer.MintToken(auth.TokenKindTenant, auth.TokenClaims{TenantID: i.tenantID}, time.Now().Add(i.lifetime)), nil
+}
+
+func readTokenCache(t *testing.T, dir string) []map[string]any {
+	t.Helper()
+
+	contents, err := os.ReadFile(filepath.Join(dir, auth.TokenCacheName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cache struct {
+		Version int              `json:"version"`
+		Entries []map[string]any `json:"entries"`
+	}
+
+	if err := json.Unmarshal(contents, &cache); err != nil {
+		t.Fatal(err)
+	}
+
+	if cache.Version != 1 {
+		t.Errorf("version = %d", cache.Version)
+	}
+
+	return cache.Entries
+}
+
+func TestDiskTokenCacheTenants(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	signer := authtest.NewSigner()
+
+	a := newCountingIssuer(signer, "tenant-a", time.Hour)
+	b := newCountingIssuer(signer, "tenant-b", time.Hour)
+
+	ta, err := auth.IssueFromDiskCache(ctx, dir, "tenant-a", time.Minute, a.issue)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tb, err := auth.IssueFromDiskCache(ctx, dir, "tenant-b", time.Minute, b.issue)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ta == tb {
+		t.Fatal("tenants share a token")
+	}
+
+	for _, tc := range []struct {
+		tenant string
+		issuer *countingIssuer
+		want   string
+	}{
+		{"tenant-a", a, ta},
+		{"tenant-b", b, tb},
+	} {
+		got, err := auth.IssueFromDiskCache(ctx, dir, tc.tenant, time.Minute, tc.issuer.issue)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got != tc.want {
+			t.Errorf("%s: cached token wasn't used", tc.tenant)
+		}
+
+		if n := tc.issuer.issued.Load(); n != 1 {
+			t.Errorf("%s: issued %d tokens, want 1", tc.tenant, n)
+		}
+	}
+
+	if entries := readTokenCache(t, dir); len(entries) != 2 {
+		t.Errorf("cache has %d entries, want 2", len(entries))
+	}
+}
+
+func TestDiskTokenCacheLongestLived(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	signer := authtest.NewSigner()
+
+	short := newCountingIssuer(signer, "tenant-a", 10*time.Minute)
+	long := newCountingIssuer(signer, "tenant-a", time.Hour)
+
+	if _, err := auth.IssueFromDiskCache(ctx, dir, "tenant-a", time.Minute, short.issue); err != nil {
+		t.Fatal(err)
+	}
+
+	// The cached token doesn't last long enough.
+	longToken, err := auth.IssueFromDiskCache(ctx, dir, "tenant-a", 30*time.Minute, long.issue)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if long.issued.Load() != 1 {
+		t.Fatalf("issued %d long-lived tokens, want 1", long.issued.Load())
+	}
+
+	// Both are valid for a minute; the one which expires last wins.
+	got, err := auth.IssueFromDiskCache(ctx, dir, "tenant-a", time.Minute, short.issue)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != longToken {
+		t.Error("the longer-lived token wasn't used")
+	}
+
+	if short.issued.Load() != 1 {
+		t.Errorf("issued %d short-lived tokens, want 1", short.issued.Load())
+	}
+}
+
+func TestDiskTokenCacheCorruptEntries(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	signer := authtest.NewSigner()
+
+	valid := signer.MintToken(auth.TokenKindTenant, auth.TokenClaims{TenantID: "tenant-a"}, time.Now().Add(time.Hour))
+	other := signer.MintToken(auth.TokenKindTenant, auth.TokenClaims{TenantID: "tenant-b"}, time.Now().Add(2*time.Hour))
+	expiry := time.Now().Add(time.Hour).Format(time.RFC3339)
+
+	contents := fmt.Sprintf(`{"version": 1, "entries": [
+		"not an entry",
+		{"tenant_id": "tenant-a", "expires_at": %q, "token": "nsct_garbage"},
+		{"tenant_id": "tenant-a", "expires_at": %q, "token": %q},
+		{"tenant_id": "tenant-a", "expires_at": %q, "token": %q}
+	]}`, expiry, expiry, other, expiry, valid)
+
+	if err := os.WriteFile(filepath.Join(dir, auth.TokenCacheName), []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	issuer := newCountingIssuer(signer, "tenant-a", time.Hour)
+	got, err := auth.IssueFromDiskCache(ctx, dir, "tenant-a", time.Minute, issuer.issue)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != valid {
+		t.Errorf("got %q, want the valid entry", got)
+	}
+
+	// A token whose claims don't match its entry is not used for either tenant.
+	if _, err := auth.IssueFromDiskCache(ctx, dir, "tenant-b", time.Minute, newCountingIssuer(signer, "tenant-b", time.Hour).issue); err != nil {
+		t.Fatal(err)
+	}
+
+	// Storing drops the corrupt entries.
+	entries := readTokenCache(t, dir)
+	if len(entries) != 2 {
+		t.Errorf("cache has %d entries, want 2: %v", len(entries), entries)
+	}
+
+	for _, e := range entries {
+		if e["token"] == other {
+			t.Error("the mismatched entry was kept")
+		}
+	}
+
+	// An unrecognized file is discarded as a whole.
+	if err := os.WriteFile(filepath.Join(dir, auth.TokenCacheName), []byte(`{"version": 2}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := issuer.issued.Load(); n != 0 {
+		t.Fatalf("issued %d tokens, want 0", n)
+	}
+
+	if _, err := auth.IssueFromDiskCache(ctx, dir, "tenant-a", time.Minute, issuer.issue); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := issuer.issued.Load(); n != 1 {
+		t.Errorf("issued %d tokens, want 1", n)
+	}
+}
+
+func TestDiskTokenCacheCap(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	signer := authtest.NewSigner()
+
+	n := auth.MaxTokenCacheEntries + 2
+	for i := 0; i < n; i++ {
+		// Later tenants' tokens expire later.
+		issuer := newCountingIssuer(signer, fmt.Sprintf("tenant-%d", i), time.Hour+time.Duration(i)*time.Minute)
+		if _, err := auth.IssueFromDiskCache(ctx, dir, issuer.tenantID, time.Minute, issuer.issue); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries := readTokenCache(t, dir)
+	if len(entries) != auth.MaxTokenCacheEntries {
+		t.Fatalf("cache has %d entries, want %d", len(entries), auth.MaxTokenCacheEntries)
+	}
+
+	// The tokens which expire first are evicted.
+	for _, e := range entries {
+		if e["tenant_id"] == "tenant-0" || e["tenant_id"] == "tenant-1" {
+			t.Errorf("%s wasn't evicted", e["tenant_id"])
+		}
+	}
+}
@@ -0,0 +1,98 @@
+//go:build unix
+
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"namespacelabs.dev/integrations/auth"
+	"namespacelabs.dev/integrations/auth/authtest"
+)
+
+func TestDiskTokenCacheConcurrentMisses(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	issuer := newCountingIssuer(authtest.NewSigner(), "tenant-a", time.Hour)
+	slowIssue := func(ctx context.Context) (string, error) {
+		time.Sleep(20 * time.Millisecond)
+		return issuer.issue(ctx)
+	}
+
+	const n = 10
+
+	var wg sync.WaitGroup
+	tokens := make([]string, n)
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tokens[i], errs[i] = auth.IssueFromDiskCache(ctx, dir, "tenant-a", time.Minute, slowIssue)
+		}(i)
+	}
+
+	wg.Wait()
+
+	for i := 0; i < n; i++ {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+
+		if tokens[i] != tokens[0] {
+			t.Errorf("caller %d got a different token", i)
+		}
+	}
+
+	if got := issuer.issued.Load(); got != 1 {
+		t.Errorf("issued %d tokens, want 1", got)
+	}
+}
+
+func TestDiskTokenCacheLockContention(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// Held through a separate file descriptor, as another process would.
+	unlock, err := auth.LockFile(ctx, filepath.Join(dir, auth.TokenCacheLockName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuer := newCountingIssuer(authtest.NewSigner(), "tenant-a", time.Hour)
+
+	// Waiting for the lock honors the context.
+	tctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := auth.IssueFromDiskCache(tctx, dir, "tenant-a", time.Minute, issuer.issue); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := auth.IssueFromDiskCache(ctx, dir, "tenant-a", time.Minute, issuer.issue)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("issued while the lock was held: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlock()
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if got := issuer.issued.Load(); got != 1 {
+		t.Errorf("issued %d tokens, want 1", got)
+	}
+}
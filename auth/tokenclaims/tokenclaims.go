@@ -0,0 +1,56 @@
+// Package tokenclaims parses the claims of Namespace tokens, without verifying
+// them. It has no dependencies on the rest of the SDK, so that it can be used
+// by the packages which auth itself depends on; most callers should use
+// auth.ParseToken or auth.ExtractClaims instead.
+package tokenclaims
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var ErrNoClaims = errors.New("token has no claims")
+
+type Claims struct {
+	jwt.RegisteredClaims
+
+	TenantID       string `json:"tenant_id"`
+	ActorID        string `json:"actor_id"`
+	InstanceID     string `json:"instance_id"`
+	OwnerID        string `json:"owner_id"`
+	PrimaryRegion  string `json:"primary_region"`
+	WorkloadRegion string `json:"workload_region"`
+}
+
+// Region returns the workload region of the token, or otherwise the tenant's
+// primary region.
+func (c *Claims) Region() string {
+	if c.WorkloadRegion != "" {
+		return c.WorkloadRegion
+	}
+
+	return c.PrimaryRegion
+}
+
+// Parse returns the claims of a Namespace token: a kind prefix (without
+// underscores), followed by an underscore and a JWT. The prefix is not checked.
+func Parse(token string) (*Claims, error) {
+	_, raw, ok := strings.Cut(token, "_")
+	if !ok {
+		return nil, ErrNoClaims
+	}
+
+	return ParseJWT(raw)
+}
+
+// ParseJWT returns the claims of the JWT embedded in a Namespace token.
+func ParseJWT(raw string) (*Claims, error) {
+	var claims Claims
+	if _, _, err := jwt.NewParser().ParseUnverified(raw, &claims); err != nil {
+		return nil, errors.Join(ErrNoClaims, err)
+	}
+
+	return &claims, nil
+}
@@ -0,0 +1,343 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"namespacelabs.dev/integrations/nsc/apienv"
+	"namespacelabs.dev/integrations/nsc/telemetry"
+)
+
+var (
+	// The token could not be parsed.
+	ErrTokenMalformed = errors.New("malformed token")
+	// The token was valid, but has expired.
+	ErrTokenExpired = errors.New("token has expired")
+	// The token's signature, issuer or audience could not be verified.
+	ErrTokenUntrusted = errors.New("token is not trusted")
+)
+
+const (
+	jwksPath = "/.well-known/jwks.json"
+
+	defaultJWKSCacheDuration = time.Hour
+	// Unknown key IDs trigger a refetch, but no more often than this.
+	minJWKSRefetchInterval = time.Minute
+)
+
+type VerifierOpts struct {
+	// The IAM endpoint which serves the key set. Defaults to the configured
+	// IAM endpoint.
+	IAMEndpoint string
+
+	// If set, overrides the URL the key set is fetched from.
+	JWKSURL string
+
+	// If set, tokens must have been issued by this issuer.
+	Issuer string
+
+	// If set, tokens must be intended for this audience.
+	Audience string
+
+	// How long a fetched key set is used for. Defaults to one hour.
+	CacheDuration time.Duration
+
+	// Used to fetch the key set. Defaults to telemetry.HTTPClient.
+	HTTPClient *http.Client
+}
+
+// Verifier validates the signature, issuer, audience and expiry of Namespace
+// tokens against a JSON Web Key Set served by IAM. Keys are cached, and
+// refetched when a token refers to a key that is not known yet.
+type Verifier struct {
+	opts    VerifierOpts
+	jwksURL string
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+	inflight  *jwksFetch // Set while the key set is being fetched.
+}
+
+// jwksFetch is a fetch of the key set, which concurrent verifications wait for
+// rather than issuing their own.
+type jwksFetch struct {
+	done chan struct{}
+	err  error
+}
+
+func NewVerifier(opts VerifierOpts) *Verifier {
+	if opts.CacheDuration <= 0 {
+		opts.CacheDuration = defaultJWKSCacheDuration
+	}
+
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = telemetry.HTTPClient
+	}
+
+	jwksURL := opts.JWKSURL
+	if jwksURL == "" {
+		endpoint := opts.IAMEndpoint
+		if endpoint == "" {
+			endpoint = apienv.IAMEndpoint()
+		}
+
+		jwksURL = strings.TrimSuffix(endpoint, "/") + jwksPath
+	}
+
+	return &Verifier{opts: opts, jwksURL: jwksURL}
+}
+
+// VerifyClaims parses token and verifies it, returning its claims. Errors wrap
+// one of ErrTokenMalformed, ErrTokenExpired or ErrTokenUntrusted.
+func (v *Verifier) VerifyClaims(ctx context.Context, token string) (*TokenClaims, error) {
+	raw, ok := tokenJWT(token)
+	if !ok {
+		return nil, fmt.Errorf("%w: unrecognized token format", ErrTokenMalformed)
+	}
+
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "EdDSA"}))
+
+	var claims TokenClaims
+	if _, err := parser.ParseWithClaims(raw, &claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.key(ctx, kid)
+	}); err != nil {
+		switch {
+		case errors.Is(err, jwt.ErrTokenMalformed):
+			return nil, fmt.Errorf("%w: %v", ErrTokenMalformed, err)
+		case errors.Is(err, jwt.ErrTokenSignatureInvalid), errors.Is(err, jwt.ErrTokenUnverifiable):
+			return nil, fmt.Errorf("%w: %v", ErrTokenUntrusted, err)
+		case errors.Is(err, jwt.ErrTokenExpired):
+			return nil, fmt.Errorf("%w: %v", ErrTokenExpired, err)
+		default:
+			return nil, fmt.Errorf("%w: %v", ErrTokenUntrusted, err)
+		}
+	}
+
+	if claims.ExpiresAt == nil {
+		return nil, fmt.Errorf("%w: token has no expiry", ErrTokenUntrusted)
+	}
+
+	if v.opts.Issuer != "" && !claims.VerifyIssuer(v.opts.Issuer, true) {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrTokenUntrusted, claims.Issuer)
+	}
+
+	if v.opts.Audience != "" && !claims.VerifyAudience(v.opts.Audience, true) {
+		return nil, fmt.Errorf("%w: token is not intended for %q", ErrTokenUntrusted, v.opts.Audience)
+	}
+
+	return &claims, nil
+}
+
+func (v *Verifier) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	if !v.needsFetchLocked(kid) {
+		k, ok := v.keys[kid]
+		v.mu.Unlock()
+		return knownKey(k, ok, kid)
+	}
+
+	// The lock is not held while fetching, so that verifications with known
+	// keys are not blocked by a slow fetch.
+	f := v.inflight
+	if f == nil {
+		f = &jwksFetch{done: make(chan struct{})}
+		v.inflight = f
+		v.mu.Unlock()
+
+		keys, err := v.fetch(ctx)
+
+		v.mu.Lock()
+		if err == nil {
+			v.keys = keys
+			v.fetchedAt = time.Now()
+		}
+		f.err = err
+		v.inflight = nil
+		close(f.done)
+		v.mu.Unlock()
+	} else {
+		v.mu.Unlock()
+
+		select {
+		case <-f.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	v.mu.Lock()
+	k, ok := v.keys[kid]
+	v.mu.Unlock()
+	return knownKey(k, ok, kid)
+}
+
+func (v *Verifier) needsFetchLocked(kid string) bool {
+	age := time.Since(v.fetchedAt)
+	if v.keys == nil || age > v.opts.CacheDuration {
+		return true
+	}
+
+	// The key set may have been rotated.
+	_, ok := v.keys[kid]
+	return !ok && age > minJWKSRefetchInterval
+}
+
+func knownKey(k crypto.PublicKey, ok bool, kid string) (crypto.PublicKey, error) {
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	return k, nil
+}
+
+func (v *Verifier) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", v.jwksURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := v.opts.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch key set: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch key set: status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("failed to parse key set: %w", err)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		pub, err := k.publicKey()
+		if err != nil {
+			// Skip keys we don't understand, rather than failing all verification.
+			continue
+		}
+
+		keys[k.Kid] = pub
+	}
+
+	return keys, nil
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+
+	// RSA.
+	N string `json:"n"`
+	E string `json:"e"`
+
+	// EC and OKP.
+	X string `json:"x"`
+	Y string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		if !e.IsInt64() {
+			return nil, errors.New("invalid RSA exponent")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+
+		return ed25519.PublicKey(x), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(v string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
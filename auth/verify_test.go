@@ -0,0 +1,319 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"namespacelabs.dev/integrations/auth"
+)
+
+type testJWKS struct {
+	mu      sync.Mutex
+	keys    map[string]ed25519.PrivateKey
+	fetches atomic.Int32
+	block   chan struct{} // If set, fetches wait until it's closed.
+	fail    bool          // If set, fetches fail.
+}
+
+// jsonWebKey is an Ed25519 key, as served in a JSON Web Key Set.
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	Use string `json:"use"`
+	X   string `json:"x"`
+}
+
+func newTestJWKS(t *testing.T, kids ...string) (*testJWKS, *httptest.Server) {
+	t.Helper()
+
+	s := &testJWKS{keys: map[string]ed25519.PrivateKey{}}
+	for _, kid := range kids {
+		s.addKey(t, kid)
+	}
+
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+
+	return s, srv
+}
+
+func (s *testJWKS) addKey(t *testing.T, kid string) {
+	t.Helper()
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.mu.Lock()
+	s.keys[kid] = priv
+	s.mu.Unlock()
+}
+
+func (s *testJWKS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.fetches.Add(1)
+
+	s.mu.Lock()
+	block, fail := s.block, s.fail
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	for kid, priv := range s.keys {
+		set.Keys = append(set.Keys, jsonWebKey{
+			Kid: kid,
+			Kty: "OKP",
+			Crv: "Ed25519",
+			Use: "sig",
+			X:   base64.RawURLEncoding.EncodeToString(priv.Public().(ed25519.PublicKey)),
+		})
+	}
+	s.mu.Unlock()
+
+	if block != nil {
+		<-block
+	}
+
+	if fail {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(set)
+}
+
+func (s *testJWKS) setFail(fail bool) {
+	s.mu.Lock()
+	s.fail = fail
+	s.mu.Unlock()
+}
+
+func (s *testJWKS) mint(t *testing.T, kid string, claims auth.TokenClaims) string {
+	t.Helper()
+
+	s.mu.Lock()
+	priv, ok := s.keys[kid]
+	s.mu.Unlock()
+
+	if !ok {
+		// Sign with a key the server doesn't know about.
+		var err error
+		if _, priv, err = ed25519.GenerateKey(rand.Reader); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tok := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	tok.Header["kid"] = kid
+
+	signed, err := tok.SignedString(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return "nsct_" + signed
+}
+
+func validClaims() auth.TokenClaims {
+	return auth.TokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "https://iam.example",
+			Audience:  jwt.ClaimStrings{"test"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		TenantID: "tenant-1",
+	}
+}
+
+// newTestVerifier returns a verifier for srv's key set, which is cached for
+// cacheDuration, or the default if zero.
+func newTestVerifier(srv *httptest.Server, cacheDuration time.Duration) *auth.Verifier {
+	return auth.NewVerifier(auth.VerifierOpts{
+		JWKSURL:       srv.URL,
+		Issuer:        "https://iam.example",
+		Audience:      "test",
+		CacheDuration: cacheDuration,
+		HTTPClient:    srv.Client(),
+	})
+}
+
+func TestVerifyClaims(t *testing.T) {
+	ctx := context.Background()
+	jwks, srv := newTestJWKS(t, "key-1")
+	v := newTestVerifier(srv, 0)
+
+	claims, err := v.VerifyClaims(ctx, jwks.mint(t, "key-1", validClaims()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.TenantID != "tenant-1" {
+		t.Errorf("tenant = %q", claims.TenantID)
+	}
+
+	expired := validClaims()
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+
+	noExpiry := validClaims()
+	noExpiry.ExpiresAt = nil
+
+	wrongIssuer := validClaims()
+	wrongIssuer.Issuer = "https://evil.example"
+
+	wrongAudience := validClaims()
+	wrongAudience.Audience = jwt.ClaimStrings{"other"}
+
+	valid := jwks.mint(t, "key-1", validClaims())
+
+	for _, tc := range []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"expired", jwks.mint(t, "key-1", expired), auth.ErrTokenExpired},
+		{"no expiry", jwks.mint(t, "key-1", noExpiry), auth.ErrTokenUntrusted},
+		{"wrong issuer", jwks.mint(t, "key-1", wrongIssuer), auth.ErrTokenUntrusted},
+		{"wrong audience", jwks.mint(t, "key-1", wrongAudience), auth.ErrTokenUntrusted},
+		{"unknown key", jwks.mint(t, "key-2", validClaims()), auth.ErrTokenUntrusted},
+		{"tampered", valid[:len(valid)-4] + "AAAA", auth.ErrTokenUntrusted},
+		{"no prefix", valid[len("nsct_"):], auth.ErrTokenMalformed},
+		{"opaque", "nsct_opaque", auth.ErrTokenMalformed},
+		{"truncated", valid[:len(valid)/2], auth.ErrTokenMalformed},
+		{"empty", "", auth.ErrTokenMalformed},
+	} {
+		if _, err := v.VerifyClaims(ctx, tc.token); !errors.Is(err, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, err, tc.want)
+		}
+	}
+
+	// Known keys are cached, and unknown keys don't trigger an immediate
+	// refetch.
+	if got := jwks.fetches.Load(); got != 1 {
+		t.Errorf("key set fetched %d times, want 1", got)
+	}
+}
+
+// cacheDuration is short enough for tests to wait for the key set to expire.
+const cacheDuration = 200 * time.Millisecond
+
+func TestVerifyClaimsRotatedKey(t *testing.T) {
+	ctx := context.Background()
+	jwks, srv := newTestJWKS(t, "key-1")
+	v := newTestVerifier(srv, cacheDuration)
+
+	if _, err := v.VerifyClaims(ctx, jwks.mint(t, "key-1", validClaims())); err != nil {
+		t.Fatal(err)
+	}
+
+	jwks.addKey(t, "key-2")
+	rotated := jwks.mint(t, "key-2", validClaims())
+
+	// The key set was fetched too recently to be refetched.
+	if _, err := v.VerifyClaims(ctx, rotated); !errors.Is(err, auth.ErrTokenUntrusted) {
+		t.Fatalf("got %v, want ErrTokenUntrusted", err)
+	}
+
+	time.Sleep(cacheDuration)
+
+	if _, err := v.VerifyClaims(ctx, rotated); err != nil {
+		t.Fatalf("after refetch: %v", err)
+	}
+
+	if got := jwks.fetches.Load(); got != 2 {
+		t.Errorf("key set fetched %d times, want 2", got)
+	}
+}
+
+func TestVerifyClaimsFetchFailure(t *testing.T) {
+	ctx := context.Background()
+	jwks, srv := newTestJWKS(t, "key-1")
+	v := newTestVerifier(srv, 0)
+
+	token := jwks.mint(t, "key-1", validClaims())
+	jwks.setFail(true)
+
+	if _, err := v.VerifyClaims(ctx, token); !errors.Is(err, auth.ErrTokenUntrusted) {
+		t.Fatalf("got %v, want ErrTokenUntrusted", err)
+	}
+
+	// Failures aren't cached.
+	jwks.setFail(false)
+
+	if _, err := v.VerifyClaims(ctx, token); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := jwks.fetches.Load(); got != 2 {
+		t.Errorf("key set fetched %d times, want 2", got)
+	}
+}
+
+func TestVerifyClaimsConcurrentFetch(t *testing.T) {
+	ctx := context.Background()
+	jwks, srv := newTestJWKS(t, "key-1")
+	v := newTestVerifier(srv, cacheDuration)
+
+	if _, err := v.VerifyClaims(ctx, jwks.mint(t, "key-1", validClaims())); err != nil {
+		t.Fatal(err)
+	}
+
+	// Block the next fetch, which is triggered once the key set expires.
+	block := make(chan struct{})
+	jwks.mu.Lock()
+	jwks.block = block
+	jwks.mu.Unlock()
+
+	jwks.addKey(t, "key-2")
+	rotated := jwks.mint(t, "key-2", validClaims())
+
+	time.Sleep(cacheDuration)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := v.VerifyClaims(ctx, rotated)
+			errs <- err
+		}()
+	}
+
+	// Wait for the fetch to start.
+	for jwks.fetches.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Waiting for the pending fetch honors the context.
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := v.VerifyClaims(cctx, rotated); !errors.Is(err, auth.ErrTokenUntrusted) {
+		t.Errorf("got %v, want ErrTokenUntrusted", err)
+	}
+
+	close(block)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	if got := jwks.fetches.Load(); got != 2 {
+		t.Errorf("key set fetched %d times, want 2", got)
+	}
+}
@@ -5,7 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"os"
+	"log/slog"
 	"strings"
 	"time"
 
@@ -20,7 +20,7 @@ func NamespaceRegistryAuth(token api.TokenSource) session.Attachable {
 }
 
 func RegistryAuth(keychain Keychain) session.Attachable {
-	return KeychainWrapper{io.Discard, os.Stderr, keychain, nil}
+	return KeychainWrapper{Keychain: keychain}
 }
 
 type Keychain interface {
@@ -48,11 +48,41 @@ func (dk tokenKeychain) Resolve(ctx context.Context, host string) (*auth.Credent
 }
 
 type KeychainWrapper struct {
+	// Deprecated: use Logger.
 	DebugLogger io.Writer
+	// Deprecated: use Logger.
 	ErrorLogger io.Writer
 	Keychain    Keychain
 
 	Fallback auth.AuthServer
+
+	// If set, credential lookups are logged at debug level, and unimplemented
+	// calls at error level. Otherwise, DebugLogger and ErrorLogger are used;
+	// if neither is set, logs go to slog.Default().
+	Logger *slog.Logger
+}
+
+func (kw KeychainWrapper) debugLog() *slog.Logger {
+	return kw.logger(kw.DebugLogger)
+}
+
+func (kw KeychainWrapper) errorLog() *slog.Logger {
+	return kw.logger(kw.ErrorLogger)
+}
+
+func (kw KeychainWrapper) logger(w io.Writer) *slog.Logger {
+	l := kw.Logger
+	switch {
+	case l != nil:
+	case w != nil && w != io.Discard:
+		l = slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	case w != nil || kw.DebugLogger != nil || kw.ErrorLogger != nil:
+		l = slog.New(slog.DiscardHandler)
+	default:
+		l = slog.Default()
+	}
+
+	return l.With("component", "buildkit")
 }
 
 func (kw KeychainWrapper) Register(server *grpc.Server) {
@@ -63,10 +93,9 @@ func (kw KeychainWrapper) Credentials(ctx context.Context, req *auth.Credentials
 	response, err := kw.credentials(ctx, req.Host)
 
 	if err == nil {
-		fmt.Fprintf(kw.DebugLogger, "[buildkit] AuthServer.Credentials %q --> %q\n", req.Host, response.Username)
+		kw.debugLog().DebugContext(ctx, "AuthServer.Credentials", "host", req.Host, "username", response.Username)
 	} else {
-		fmt.Fprintf(kw.DebugLogger, "[buildkit] AuthServer.Credentials %q: failed: %v\n", req.Host, err)
-
+		kw.debugLog().DebugContext(ctx, "AuthServer.Credentials failed", "host", req.Host, "error", err)
 	}
 
 	return response, err
@@ -90,7 +119,7 @@ func (kw KeychainWrapper) FetchToken(ctx context.Context, req *auth.FetchTokenRe
 		return kw.Fallback.FetchToken(ctx, req)
 	}
 
-	fmt.Fprintf(kw.ErrorLogger, "AuthServer.FetchToken %s\n", asJson(req))
+	kw.errorLog().ErrorContext(ctx, "AuthServer.FetchToken", "request", asJson(req))
 	return nil, fmt.Errorf("unimplemented")
 }
 
@@ -99,7 +128,7 @@ func (kw KeychainWrapper) GetTokenAuthority(ctx context.Context, req *auth.GetTo
 		return kw.Fallback.GetTokenAuthority(ctx, req)
 	}
 
-	fmt.Fprintf(kw.ErrorLogger, "AuthServer.GetTokenAuthority %s\n", asJson(req))
+	kw.errorLog().ErrorContext(ctx, "AuthServer.GetTokenAuthority", "request", asJson(req))
 	return nil, fmt.Errorf("unimplemented")
 }
 
@@ -108,7 +137,7 @@ func (kw KeychainWrapper) VerifyTokenAuthority(ctx context.Context, req *auth.Ve
 		return kw.Fallback.VerifyTokenAuthority(ctx, req)
 	}
 
-	fmt.Fprintf(kw.ErrorLogger, "AuthServer.VerifyTokenAuthority %s\n", asJson(req))
+	kw.errorLog().ErrorContext(ctx, "AuthServer.VerifyTokenAuthority", "request", asJson(req))
 	return nil, fmt.Errorf("unimplemented")
 }
 
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
 
 	"github.com/google/go-containerregistry/pkg/name"
@@ -18,8 +19,37 @@ import (
 	"namespacelabs.dev/integrations/buildkit"
 )
 
+// Builder builds images on Namespace builders.
+type Builder struct {
+	Token api.TokenSource
+	// If set, builds are logged at debug level.
+	Logger *slog.Logger
+}
+
+// BuildImageFromDockerfileAndContext builds localDir with its Dockerfile, using
+// debugLog for debug output.
+//
+// Deprecated: use Builder.
 func BuildImageFromDockerfileAndContext(ctx context.Context, debugLog io.Writer, token api.TokenSource, relName, localDir string) (string, error) {
-	cli, err := builds.NewClient(ctx, token)
+	var logger *slog.Logger
+	if debugLog != nil && debugLog != io.Discard {
+		logger = slog.New(slog.NewTextHandler(debugLog, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
+
+	return Builder{Token: token, Logger: logger}.BuildImageFromDockerfileAndContext(ctx, relName, localDir)
+}
+
+// BuildImageFromDockerfileAndContext builds localDir with its Dockerfile on a
+// Namespace builder, and pushes the image to relName in the tenant's registry.
+func (b Builder) BuildImageFromDockerfileAndContext(ctx context.Context, relName, localDir string) (string, error) {
+	logger := b.Logger
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+
+	logger = logger.With("component", "buildkit")
+
+	cli, err := builds.NewClient(ctx, b.Token)
 	if err != nil {
 		return "", err
 	}
@@ -41,7 +71,7 @@ func BuildImageFromDockerfileAndContext(ctx context.Context, debugLog io.Writer,
 		return "", err
 	}
 
-	target, err := builds.NSCRImage(ctx, token, relName)
+	target, err := builds.NSCRImage(ctx, b.Token, relName)
 	if err != nil {
 		return "", err
 	}
@@ -73,7 +103,7 @@ func BuildImageFromDockerfileAndContext(ctx context.Context, debugLog io.Writer,
 		},
 	}
 
-	solveOpt.Session = append(solveOpt.Session, buildkit.NamespaceRegistryAuth(token))
+	solveOpt.Session = append(solveOpt.Session, buildkit.NamespaceRegistryAuth(b.Token))
 
 	ch := make(chan *client.SolveStatus)
 
@@ -81,6 +111,8 @@ func BuildImageFromDockerfileAndContext(ctx context.Context, debugLog io.Writer,
 		_, _ = display.UpdateFrom(ctx, ch)
 	}()
 
+	logger.DebugContext(ctx, "Building image", "target", target, "context", localDir)
+
 	resp, err := bk.Solve(ctx, nil, solveOpt, ch)
 	if err != nil {
 		return "", err
@@ -91,5 +123,7 @@ func BuildImageFromDockerfileAndContext(ctx context.Context, debugLog io.Writer,
 		return "", fmt.Errorf("digest missing from the output")
 	}
 
+	logger.DebugContext(ctx, "Built image", "target", target, "digest", digest)
+
 	return nd.Digest(digest).Name(), nil
 }
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"namespacelabs.dev/integrations/auth"
+	"namespacelabs.dev/integrations/auth/metadata"
+)
+
+var (
+	listen      = flag.String("listen", "127.0.0.1:0", "Where to serve: a loopback host:port, or a unix socket path prefixed with unix:.")
+	allowRemote = flag.Bool("allow_non_loopback", false, "If set, --listen may be an address which other hosts can reach. Use with --clients_file.")
+	clientsFile = flag.String("clients_file", "", "If set, a JSON list of clients ({name, key, audiences}) which may obtain tokens; others are refused.")
+	verbose     = flag.Bool("verbose", false, "If set, logs every request.")
+)
+
+func main() {
+	flag.Parse()
+
+	if err := run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.ExitCode())
+		}
+
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	token, err := auth.LoadDefaults()
+	if err != nil {
+		return err
+	}
+
+	opts := metadata.ServerOpts{}
+	if *verbose {
+		opts.Logger = slog.Default()
+	}
+
+	if *clientsFile != "" {
+		contents, err := os.ReadFile(*clientsFile)
+		if err != nil {
+			return err
+		}
+
+		if err := json.Unmarshal(contents, &opts.Clients); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", *clientsFile, err)
+		}
+	}
+
+	lis, err := metadata.Listen(*listen, metadata.ListenOpts{AllowNonLoopback: *allowRemote})
+	if err != nil {
+		return err
+	}
+
+	endpoint := lis.Addr().String()
+	if lis.Addr().Network() == "unix" {
+		endpoint = "unix:" + endpoint
+	}
+
+	srv := &http.Server{Handler: metadata.NewServer(token, opts)}
+	go func() {
+		if err := srv.Serve(lis); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	defer srv.Close()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	if flag.NArg() == 0 {
+		log.Printf("Serving on %s", endpoint)
+		<-ctx.Done()
+		return nil
+	}
+
+	// Run the command with access to the server, and exit with it.
+	cmd := exec.CommandContext(ctx, flag.Arg(0), flag.Args()[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), metadata.EndpointEnv+"="+endpoint)
+
+	return cmd.Run()
+}
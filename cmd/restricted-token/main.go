@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"namespacelabs.dev/integrations/auth"
+)
+
+type grantsFlag []auth.Grant
+
+func (g *grantsFlag) String() string {
+	var parts []string
+	for _, grant := range *g {
+		parts = append(parts, fmt.Sprintf("%s:%s:%s", grant.ResourceType, grant.ResourceID, strings.Join(grant.Actions, ",")))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// Set parses grants of the form <resource_type>:<resource_id>:<action>[,<action>...].
+func (g *grantsFlag) Set(value string) error {
+	first := strings.IndexByte(value, ':')
+	last := strings.LastIndexByte(value, ':')
+	if first < 0 || first == last {
+		return fmt.Errorf("expected <resource_type>:<resource_id>:<actions>, got %q", value)
+	}
+
+	actions := strings.Split(value[last+1:], ",")
+	if value[last+1:] == "" {
+		return fmt.Errorf("%q: no actions specified", value)
+	}
+
+	*g = append(*g, auth.Grant{
+		ResourceType: value[:first],
+		ResourceID:   value[first+1 : last],
+		Actions:      actions,
+	})
+
+	return nil
+}
+
+func (g *grantsFlag) addPush(repository string) error {
+	grant, err := auth.PushToRepository(repository)
+	if err != nil {
+		return err
+	}
+
+	*g = append(*g, grant)
+	return nil
+}
+
+func (g *grantsFlag) addStorageRead(namespace string) error {
+	if namespace == "" {
+		return errors.New("no storage namespace specified")
+	}
+
+	*g = append(*g, auth.ReadStorageNamespace(namespace))
+	return nil
+}
+
+var (
+	name        = flag.String("name", "", "The name of the token to issue.")
+	description = flag.String("description", "", "A description of the token to issue.")
+	duration    = flag.Duration("duration", time.Hour, "For how long the issued token is valid.")
+	tokenFile   = flag.String("token_file", "", "If set, writes the issued token as a token file usable with NSC_TOKEN_FILE, rather than to stdout.")
+	tokenID     = flag.String("token_id", "", "The token to revoke.")
+	grants      grantsFlag
+)
+
+func main() {
+	flag.Var(&grants, "grant", "A permission granted to the issued token, as <resource_type>:<resource_id>:<action>[,<action>...]. Can be repeated.")
+	flag.Func("push_repository", "Allows the issued token to push to this nscr.io repository. Can be repeated.", grants.addPush)
+	flag.Func("read_storage_namespace", "Allows the issued token to read this storage namespace. Can be repeated.", grants.addStorageRead)
+	flag.Parse()
+
+	var err error
+	switch flag.Arg(0) {
+	case "issue":
+		err = issue(context.Background())
+
+	case "revoke":
+		err = revoke(context.Background())
+
+	default:
+		err = errors.New("usage: restricted-token [flags] issue|revoke")
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func issue(ctx context.Context) error {
+	if *name == "" {
+		return errors.New("--name is required")
+	}
+
+	if len(grants) == 0 {
+		return errors.New("at least one of --grant, --push_repository or --read_storage_namespace is required")
+	}
+
+	parent, err := auth.LoadDefaults()
+	if err != nil {
+		return err
+	}
+
+	tok, err := auth.IssueRestrictedToken(ctx, parent, auth.RestrictedTokenOpts{
+		Name:        *name,
+		Description: *description,
+		Duration:    *duration,
+		Grants:      grants,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Issued %s, expires at %v.\n", tok.TokenID, tok.ExpiresAt.Format(time.RFC3339))
+
+	if *tokenFile == "" {
+		fmt.Fprintf(os.Stdout, "%s\n", tok.BearerToken)
+		return nil
+	}
+
+	contents, err := json.Marshal(map[string]string{
+		"bearer_token": tok.BearerToken,
+	})
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(*tokenFile, contents, 0600)
+}
+
+func revoke(ctx context.Context) error {
+	if *tokenID == "" {
+		return errors.New("--token_id is required")
+	}
+
+	parent, err := auth.LoadDefaults()
+	if err != nil {
+		return err
+	}
+
+	if err := auth.RevokeRestrictedToken(ctx, parent, *tokenID); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Revoked %s.\n", *tokenID)
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"namespacelabs.dev/integrations/auth"
+)
+
+func TestGrantsFlag(t *testing.T) {
+	var g grantsFlag
+	for _, v := range []string{"instance:inst-1:read,write", "secret:path:with:colons:read"} {
+		if err := g.Set(v); err != nil {
+			t.Fatalf("Set(%q): %v", v, err)
+		}
+	}
+
+	if err := g.addPush("nscr.io/tenant/app:latest"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := g.addStorageRead("cache"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := grantsFlag{
+		{ResourceType: "instance", ResourceID: "inst-1", Actions: []string{"read", "write"}},
+		{ResourceType: "secret", ResourceID: "path:with:colons", Actions: []string{"read"}},
+		{ResourceType: auth.ResourceTypeRepository, ResourceID: "tenant/app", Actions: []string{auth.ActionPush}},
+		{ResourceType: auth.ResourceTypeStorageNamespace, ResourceID: "cache", Actions: []string{auth.ActionRead}},
+	}
+
+	if !reflect.DeepEqual(g, want) {
+		t.Errorf("got %+v, want %+v", g, want)
+	}
+
+	for _, v := range []string{"instance", "instance:read", "instance:inst-1:"} {
+		if err := g.Set(v); err == nil {
+			t.Errorf("Set(%q) succeeded", v)
+		}
+	}
+
+	if err := g.addPush("docker.io/library/app"); err == nil {
+		t.Error("a push grant to another registry was accepted")
+	}
+
+	if err := g.addStorageRead(""); err == nil {
+		t.Error("a read grant without a namespace was accepted")
+	}
+}
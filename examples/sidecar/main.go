@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"net"
 	"os"
 	"os/signal"
@@ -79,7 +80,10 @@ func do(ctx context.Context) error {
 }
 
 func buildAndOptimize(ctx context.Context, cli compute.Client, debugLog io.Writer, token api.TokenSource, relName, localDir string) (string, error) {
-	built, err := buildhelper.BuildImageFromDockerfileAndContext(ctx, debugLog, token, relName, localDir)
+	built, err := buildhelper.Builder{
+		Token:  token,
+		Logger: slog.New(slog.NewTextHandler(debugLog, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	}.BuildImageFromDockerfileAndContext(ctx, relName, localDir)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,45 @@
+// Package fsutil holds file system helpers shared by the SDK's packages.
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// WriteFileAtomic writes contents to path with permissions perm, by writing a
+// temporary file in the same directory and renaming it over path. Readers never
+// observe a partially written file.
+func WriteFileAtomic(path string, contents []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+
+	success := false
+	defer func() {
+		if !success {
+			os.Remove(f.Name())
+		}
+	}()
+
+	if _, err := f.Write(contents); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+
+	success = true
+	return nil
+}
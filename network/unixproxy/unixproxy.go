@@ -6,15 +6,16 @@ package unixproxy
 
 import (
 	"context"
-	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"net"
 	"os"
 
 	"golang.org/x/sys/unix"
 	"namespacelabs.dev/go-ids"
 	"namespacelabs.dev/integrations/network/netcopy"
+	"namespacelabs.dev/integrations/nsc/logging"
 )
 
 type Proxy struct {
@@ -23,6 +24,10 @@ type Proxy struct {
 }
 
 type ProxyOpts struct {
+	// If set, connections are logged at debug level, and failures at error
+	// level. Otherwise, Debug and Errors are used.
+	Logger *slog.Logger
+	// Deprecated: use Logger.
 	Debug, Errors  io.Writer
 	SocketPath     string
 	Blocking       bool
@@ -31,6 +36,11 @@ type ProxyOpts struct {
 }
 
 func RunProxy(ctx context.Context, opts ProxyOpts) (*Proxy, error) {
+	debugLog, errorLog := opts.Logger, opts.Logger
+	if opts.Logger == nil {
+		debugLog, errorLog = logging.FromWriter(opts.Debug), logging.FromWriter(opts.Errors)
+	}
+
 	if err := unix.Unlink(opts.SocketPath); err != nil && !os.IsNotExist(err) {
 		return nil, err
 	}
@@ -58,7 +68,7 @@ func RunProxy(ctx context.Context, opts ProxyOpts) (*Proxy, error) {
 		defer close(ch)
 		defer os.Remove(opts.SocketPath)
 
-		if err := serveProxy(ctx, opts.Debug, opts.Errors, listener, func(ctx context.Context) (net.Conn, error) {
+		if err := serveProxy(ctx, debugLog, errorLog, listener, func(ctx context.Context) (net.Conn, error) {
 			return opts.Connect(ctx)
 		}); err != nil {
 			if ctxErr := ctx.Err(); ctxErr != nil {
@@ -72,7 +82,7 @@ func RunProxy(ctx context.Context, opts ProxyOpts) (*Proxy, error) {
 	} else {
 		ctxWithCancel, cancel := context.WithCancel(ctx)
 		go func() {
-			if err := serveProxy(ctxWithCancel, opts.Debug, opts.Errors, listener, func(ctx context.Context) (net.Conn, error) {
+			if err := serveProxy(ctxWithCancel, debugLog, errorLog, listener, func(ctx context.Context) (net.Conn, error) {
 				return opts.Connect(ctx)
 			}); err != nil {
 				log.Fatal(err)
@@ -86,7 +96,7 @@ func RunProxy(ctx context.Context, opts ProxyOpts) (*Proxy, error) {
 	}
 }
 
-func serveProxy(ctx context.Context, debugLog, errorLog io.Writer, listener net.Listener, connect func(context.Context) (net.Conn, error)) error {
+func serveProxy(ctx context.Context, debugLog, errorLog *slog.Logger, listener net.Listener, connect func(context.Context) (net.Conn, error)) error {
 	for {
 		rawConn, err := listener.Accept()
 		if err != nil {
@@ -96,20 +106,16 @@ func serveProxy(ctx context.Context, debugLog, errorLog io.Writer, listener net.
 		conn := withAddress{rawConn, "local connection"}
 
 		go func() {
-			var d netcopy.DebugLogFunc
-
 			id := ids.NewRandomBase32ID(4)
-			fmt.Fprintf(debugLog, "[%s] new connection\n", id)
+			debugLog.DebugContext(ctx, "New connection", "conn_id", id)
 
-			d = func(format string, args ...any) {
-				fmt.Fprintf(debugLog, "["+id+"]: "+format+"\n", args...)
-			}
+			d := netcopy.DebugLogFunc(logging.Printf(debugLog, "conn_id", id))
 
 			defer conn.Close()
 
 			peerConn, err := connect(ctx)
 			if err != nil {
-				fmt.Fprintf(errorLog, "Failed to connect: %v\n", err)
+				errorLog.ErrorContext(ctx, "Failed to connect", "conn_id", id, "error", err)
 				return
 			}
 
@@ -1,9 +1,17 @@
 package apienv
 
-import "os"
+import (
+	"os"
+
+	"namespacelabs.dev/integrations/nsc/profile"
+)
+
+// Endpoints are resolved from environment variables first, then from the
+// overrides of the active profile, and finally fall back to the defaults.
+// The active profile is resolved once, see profile.Active.
 
 func IAMEndpoint() string {
-	if v := os.Getenv("NSC_IAM_ENDPOINT"); v != "" {
+	if v := override("NSC_IAM_ENDPOINT", func(p profile.Profile) string { return p.IAMEndpoint }); v != "" {
 		return v
 	}
 
@@ -11,9 +19,59 @@ func IAMEndpoint() string {
 }
 
 func GlobalEndpoint() string {
-	if v := os.Getenv("NSC_GLOBAL_ENDPOINT"); v != "" {
+	if v := override("NSC_GLOBAL_ENDPOINT", func(p profile.Profile) string { return p.GlobalEndpoint }); v != "" {
 		return v
 	}
 
 	return "https://private-api.global.namespaceapis.com"
 }
+
+const (
+	DefaultComputeEndpoint = "https://us.compute.namespaceapis.com"
+	DefaultStorageEndpoint = "https://ord.storage.namespaceapis.com"
+)
+
+// ComputeEndpoint is used by the compute, builds and vault clients. Clients
+// which know their tenant's region resolve a regional endpoint instead, see
+// nsc/endpoints.
+func ComputeEndpoint() string {
+	if v := ComputeEndpointOverride(); v != "" {
+		return v
+	}
+
+	return DefaultComputeEndpoint
+}
+
+// ComputeEndpointOverride returns the compute endpoint set in the environment
+// or in the active profile, if any.
+func ComputeEndpointOverride() string {
+	return override("NSC_ENDPOINT", func(p profile.Profile) string { return p.ComputeEndpoint })
+}
+
+func StorageEndpoint() string {
+	if v := StorageEndpointOverride(); v != "" {
+		return v
+	}
+
+	return DefaultStorageEndpoint
+}
+
+// StorageEndpointOverride returns the storage endpoint set in the environment
+// or in the active profile, if any.
+func StorageEndpointOverride() string {
+	return override("NSC_STORAGE_ENDPOINT", func(p profile.Profile) string { return p.StorageEndpoint })
+}
+
+func override(env string, fromProfile func(profile.Profile) string) string {
+	if v := os.Getenv(env); v != "" {
+		return v
+	}
+
+	// A profile that can't be loaded has no overrides; credential loading
+	// surfaces the problem.
+	if p, err := profile.LoadActive(); err == nil {
+		return fromProfile(p)
+	}
+
+	return ""
+}
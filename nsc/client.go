@@ -0,0 +1,202 @@
+package nsc
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"google.golang.org/grpc"
+	"namespacelabs.dev/integrations/api"
+	"namespacelabs.dev/integrations/api/builds"
+	"namespacelabs.dev/integrations/api/compute"
+	"namespacelabs.dev/integrations/api/iam"
+	registry "namespacelabs.dev/integrations/api/registry"
+	"namespacelabs.dev/integrations/api/storage"
+	"namespacelabs.dev/integrations/api/vault"
+	"namespacelabs.dev/integrations/nsc/endpoints"
+	"namespacelabs.dev/integrations/nsc/grpcapi"
+)
+
+// Client is the entry point to the Namespace APIs. It's configured once, with a
+// token and the options described in grpcapi.Options, and creates the clients
+// of each API when they're first requested. APIs which are served from the
+// same endpoint share a connection.
+//
+// The clients returned by Client share its connections, so closing them has no
+// effect; Close closes all of them.
+type Client struct {
+	token api.TokenSource
+	opts  []grpc.DialOption
+	o     grpcapi.Options
+
+	mu        sync.Mutex
+	endpoints map[endpoints.Service]string // Resolved endpoints.
+	conns     map[string]*grpc.ClientConn  // Keyed by endpoint.
+	closed    bool
+}
+
+var ErrClosed = errors.New("nsc: client is closed")
+
+func NewClient(token api.TokenSource, opts ...grpc.DialOption) *Client {
+	return &Client{
+		token:     token,
+		opts:      opts,
+		o:         grpcapi.ParseOptions(opts...),
+		endpoints: map[endpoints.Service]string{},
+		conns:     map[string]*grpc.ClientConn{},
+	}
+}
+
+// The clients below embed the clients of each API, and are returned by
+// Client. Their Close is a no-op, as their connection is shared.
+
+type ComputeClient struct{ compute.Client }
+
+func (ComputeClient) Close() error { return nil }
+
+type StorageClient struct{ storage.Client }
+
+func (StorageClient) Close() error { return nil }
+
+type BuildsClient struct{ builds.Client }
+
+func (BuildsClient) Close() error { return nil }
+
+type IAMClient struct{ iam.Client }
+
+func (IAMClient) Close() error { return nil }
+
+type VaultClient struct{ vault.Client }
+
+func (VaultClient) Close() error { return nil }
+
+type RegistryClient struct{ registry.Client }
+
+func (RegistryClient) Close() error { return nil }
+
+func (c *Client) Compute(ctx context.Context) (ComputeClient, error) {
+	conn, err := c.conn(ctx, endpoints.Compute)
+	if err != nil {
+		return ComputeClient{}, err
+	}
+
+	return ComputeClient{compute.NewClientFromConn(conn)}, nil
+}
+
+func (c *Client) Storage(ctx context.Context) (StorageClient, error) {
+	conn, err := c.conn(ctx, endpoints.Storage)
+	if err != nil {
+		return StorageClient{}, err
+	}
+
+	cli := storage.NewClientFromConn(conn)
+	cli.HTTPClient = c.o.HTTPClient
+	return StorageClient{cli}, nil
+}
+
+func (c *Client) Builds(ctx context.Context) (BuildsClient, error) {
+	conn, err := c.conn(ctx, endpoints.Compute)
+	if err != nil {
+		return BuildsClient{}, err
+	}
+
+	return BuildsClient{builds.NewClientFromConn(conn)}, nil
+}
+
+func (c *Client) IAM(ctx context.Context) (IAMClient, error) {
+	conn, err := c.conn(ctx, endpoints.IAM)
+	if err != nil {
+		return IAMClient{}, err
+	}
+
+	return IAMClient{iam.NewClientFromConn(conn)}, nil
+}
+
+func (c *Client) Vault(ctx context.Context) (VaultClient, error) {
+	conn, err := c.conn(ctx, endpoints.Compute)
+	if err != nil {
+		return VaultClient{}, err
+	}
+
+	return VaultClient{vault.NewClientFromConn(conn)}, nil
+}
+
+func (c *Client) Registry(ctx context.Context) (RegistryClient, error) {
+	conn, err := c.conn(ctx, endpoints.Global)
+	if err != nil {
+		return RegistryClient{}, err
+	}
+
+	return RegistryClient{registry.NewClientFromConn(conn)}, nil
+}
+
+// Close closes every connection the client has opened.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+
+	var errs []error
+	for endpoint, conn := range c.conns {
+		errs = append(errs, conn.Close())
+		delete(c.conns, endpoint)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c *Client) conn(ctx context.Context, service endpoints.Service) (*grpc.ClientConn, error) {
+	endpoint, err := c.endpoint(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil, ErrClosed
+	}
+
+	if conn, ok := c.conns[endpoint]; ok {
+		return conn, nil
+	}
+
+	// Dialing doesn't block, connections are established on first use.
+	conn, err := grpcapi.NewConnectionWithEndpoint(ctx, endpoint, c.token, c.opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	c.conns[endpoint] = conn
+	return conn, nil
+}
+
+// endpoint returns the endpoint of service, which is resolved once.
+func (c *Client) endpoint(ctx context.Context, service endpoints.Service) (string, error) {
+	if c.o.Endpoint != "" {
+		return c.o.Endpoint, nil
+	}
+
+	c.mu.Lock()
+	endpoint, ok := c.endpoints[service]
+	c.mu.Unlock()
+
+	if ok {
+		return endpoint, nil
+	}
+
+	// Resolved without holding the lock, as it may issue a token. Concurrent
+	// first uses may both resolve, with the same result.
+	endpoint, err := endpoints.Endpoint(ctx, service, c.token)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	c.endpoints[service] = endpoint
+	c.mu.Unlock()
+
+	return endpoint, nil
+}
@@ -0,0 +1,126 @@
+package nsc_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/connectivity"
+	"namespacelabs.dev/integrations/auth"
+	"namespacelabs.dev/integrations/auth/authtest"
+	"namespacelabs.dev/integrations/nsc"
+)
+
+// regionalToken issues a new token, for a tenant in the "us" region, on every
+// call.
+type regionalToken struct {
+	signer *authtest.Signer
+	issued atomic.Int32
+}
+
+func (ts *regionalToken) IssueToken(context.Context, time.Duration, bool) (string, error) {
+	ts.issued.Add(1)
+	return ts.signer.MintToken(auth.TokenKindTenant, auth.TokenClaims{TenantID: "tenant-1", PrimaryRegion: "us"}, time.Now().Add(time.Hour)), nil
+}
+
+func setup(t *testing.T) *regionalToken {
+	t.Helper()
+
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	for _, env := range []string{"NSC_PROFILE", "NSC_ENDPOINT", "NSC_STORAGE_ENDPOINT", "NSC_IAM_ENDPOINT", "NSC_GLOBAL_ENDPOINT"} {
+		t.Setenv(env, "")
+	}
+
+	return &regionalToken{signer: authtest.NewSigner()}
+}
+
+func TestClientSharesConnections(t *testing.T) {
+	token := setup(t)
+	c := nsc.NewClient(token)
+	defer c.Close()
+
+	ctx := context.Background()
+
+	compute, err := c.Compute(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builds, err := c.Builds(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vault, err := c.Vault(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if compute.Conn != builds.Conn || compute.Conn != vault.Conn {
+		t.Error("APIs served by the compute endpoint don't share a connection")
+	}
+
+	if got := compute.Conn.Target(); got != "us.compute.namespaceapis.com:443" {
+		t.Errorf("compute connects to %q", got)
+	}
+
+	iam, err := c.IAM(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if iam.Conn == compute.Conn {
+		t.Error("IAM shares the compute connection")
+	}
+
+	again, err := c.Compute(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if again.Conn != compute.Conn {
+		t.Error("a second compute client has its own connection")
+	}
+
+	// The compute endpoint is only resolved once; IAM's isn't regional.
+	if n := token.issued.Load(); n != 1 {
+		t.Errorf("issued %d tokens to resolve endpoints, want 1", n)
+	}
+}
+
+func TestClientClose(t *testing.T) {
+	c := nsc.NewClient(setup(t))
+	ctx := context.Background()
+
+	compute, err := c.Compute(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The returned clients don't close the shared connection.
+	if err := compute.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if compute.Conn.GetState() == connectivity.Shutdown {
+		t.Fatal("closing the compute client closed the shared connection")
+	}
+
+	if builds, err := c.Builds(ctx); err != nil || builds.Conn != compute.Conn {
+		t.Errorf("Builds() = %v, %v after closing the compute client", builds.Conn, err)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if compute.Conn.GetState() != connectivity.Shutdown {
+		t.Error("the connection is still open after Close")
+	}
+
+	if _, err := c.Compute(ctx); !errors.Is(err, nsc.ErrClosed) {
+		t.Errorf("Compute() after Close: got %v, want ErrClosed", err)
+	}
+}
@@ -0,0 +1,128 @@
+// Package endpoints resolves the API endpoints that clients connect to.
+//
+// Compute and storage are served from regional endpoints, which are derived
+// from the region named by the claims of the tenant's token (its workload
+// region, or otherwise its primary region). Tokens which don't name a region
+// use the default endpoints. Endpoints set in the environment or in the active
+// profile (see nsc/apienv) always win.
+package endpoints
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"namespacelabs.dev/integrations/api"
+	"namespacelabs.dev/integrations/auth/tokenclaims"
+	"namespacelabs.dev/integrations/nsc/apienv"
+)
+
+// Service identifies the API that an endpoint is resolved for.
+type Service string
+
+const (
+	Global  Service = "global"
+	IAM     Service = "iam"
+	Compute Service = "compute"
+	Storage Service = "storage"
+)
+
+// Regional holds the endpoints of a region.
+type Regional struct {
+	Compute string
+	Storage string
+}
+
+// Storage is served from a location within the region, rather than from the
+// region itself, in these regions.
+var storageLocations = map[string]string{
+	"us": "ord",
+}
+
+var validRegion = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// ForRegion returns the endpoints of region. An empty region has the default
+// endpoints.
+func ForRegion(region string) (Regional, error) {
+	if region == "" {
+		return Regional{Compute: apienv.DefaultComputeEndpoint, Storage: apienv.DefaultStorageEndpoint}, nil
+	}
+
+	if !validRegion.MatchString(region) {
+		return Regional{}, fmt.Errorf("invalid region %q", region)
+	}
+
+	storage := region
+	if loc, ok := storageLocations[region]; ok {
+		storage = loc
+	}
+
+	return Regional{
+		Compute: fmt.Sprintf("https://%s.compute.namespaceapis.com", region),
+		Storage: fmt.Sprintf("https://%s.storage.namespaceapis.com", storage),
+	}, nil
+}
+
+// Endpoint returns the endpoint of service for the tenant of token. Resolving
+// a regional endpoint issues a token, and fails if it can't be issued.
+func Endpoint(ctx context.Context, service Service, token api.TokenSource) (string, error) {
+	switch service {
+	case Global:
+		return apienv.GlobalEndpoint(), nil
+
+	case IAM:
+		return apienv.IAMEndpoint(), nil
+
+	case Compute:
+		if v := apienv.ComputeEndpointOverride(); v != "" {
+			return v, nil
+		}
+
+		e, err := Resolve(ctx, token)
+		if err != nil {
+			return "", err
+		}
+
+		return e.Compute, nil
+
+	case Storage:
+		if v := apienv.StorageEndpointOverride(); v != "" {
+			return v, nil
+		}
+
+		e, err := Resolve(ctx, token)
+		if err != nil {
+			return "", err
+		}
+
+		return e.Storage, nil
+	}
+
+	return "", fmt.Errorf("unknown service %q", service)
+}
+
+// Resolve returns the regional endpoints of the tenant of token, ignoring
+// overrides. A nil token has the default endpoints.
+func Resolve(ctx context.Context, token api.TokenSource) (Regional, error) {
+	if token == nil {
+		return ForRegion("")
+	}
+
+	bt, err := token.IssueToken(ctx, 5*time.Minute, false)
+	if err != nil {
+		return Regional{}, fmt.Errorf("failed to resolve the tenant's region: %w", err)
+	}
+
+	return ForRegion(regionOf(bt))
+}
+
+// regionOf returns the region named by the claims of token, if any.
+func regionOf(token string) string {
+	claims, err := tokenclaims.Parse(token)
+	if err != nil {
+		return ""
+	}
+
+	return claims.Region()
+}
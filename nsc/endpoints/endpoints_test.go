@@ -0,0 +1,127 @@
+package endpoints
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+type staticToken string
+
+func (s staticToken) IssueToken(context.Context, time.Duration, bool) (string, error) {
+	return string(s), nil
+}
+
+type failingToken struct{}
+
+func (failingToken) IssueToken(context.Context, time.Duration, bool) (string, error) {
+	return "", errors.New("no credentials")
+}
+
+func tenantToken(t *testing.T, primary, workload string) staticToken {
+	t.Helper()
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"tenant_id":       "tenant-1",
+		"primary_region":  primary,
+		"workload_region": workload,
+	}).SignedString([]byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return staticToken("nsct_" + signed)
+}
+
+func TestForRegion(t *testing.T) {
+	for _, tc := range []struct {
+		region  string
+		compute string
+		storage string
+	}{
+		{"", "https://us.compute.namespaceapis.com", "https://ord.storage.namespaceapis.com"},
+		{"us", "https://us.compute.namespaceapis.com", "https://ord.storage.namespaceapis.com"},
+		{"eu", "https://eu.compute.namespaceapis.com", "https://eu.storage.namespaceapis.com"},
+	} {
+		got, err := ForRegion(tc.region)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.region, err)
+		}
+
+		if got.Compute != tc.compute || got.Storage != tc.storage {
+			t.Errorf("ForRegion(%q) = %+v, want compute %q and storage %q", tc.region, got, tc.compute, tc.storage)
+		}
+	}
+
+	for _, region := range []string{"EU", "eu.evil.com/", "eu:443", "-eu"} {
+		if _, err := ForRegion(region); err == nil {
+			t.Errorf("ForRegion(%q) succeeded", region)
+		}
+	}
+}
+
+func TestEndpointFromClaims(t *testing.T) {
+	t.Setenv("NSC_ENDPOINT", "")
+	t.Setenv("NSC_STORAGE_ENDPOINT", "")
+	t.Setenv("NSC_PROFILE", "")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		name              string
+		primary, workload string
+		compute, storage  string
+	}{
+		{"primary region", "eu", "", "https://eu.compute.namespaceapis.com", "https://eu.storage.namespaceapis.com"},
+		{"workload region wins", "us", "eu", "https://eu.compute.namespaceapis.com", "https://eu.storage.namespaceapis.com"},
+		{"us", "us", "", "https://us.compute.namespaceapis.com", "https://ord.storage.namespaceapis.com"},
+		{"no region", "", "", "https://us.compute.namespaceapis.com", "https://ord.storage.namespaceapis.com"},
+	} {
+		token := tenantToken(t, tc.primary, tc.workload)
+
+		if got, err := Endpoint(ctx, Compute, token); err != nil || got != tc.compute {
+			t.Errorf("%s: compute = %q, %v; want %q", tc.name, got, err, tc.compute)
+		}
+
+		if got, err := Endpoint(ctx, Storage, token); err != nil || got != tc.storage {
+			t.Errorf("%s: storage = %q, %v; want %q", tc.name, got, err, tc.storage)
+		}
+	}
+}
+
+func TestEndpointErrors(t *testing.T) {
+	t.Setenv("NSC_ENDPOINT", "")
+	t.Setenv("NSC_STORAGE_ENDPOINT", "")
+	t.Setenv("NSC_PROFILE", "")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	ctx := context.Background()
+
+	if _, err := Endpoint(ctx, Compute, failingToken{}); err == nil {
+		t.Error("expected an error when a token can't be issued")
+	}
+
+	if _, err := Endpoint(ctx, Storage, tenantToken(t, "EU/../", "")); err == nil {
+		t.Error("expected an error for an invalid region")
+	}
+}
+
+func TestEndpointOverrides(t *testing.T) {
+	t.Setenv("NSC_ENDPOINT", "compute.example:443")
+	t.Setenv("NSC_STORAGE_ENDPOINT", "storage.example:443")
+
+	ctx := context.Background()
+
+	// Overrides don't require a token.
+	if got, err := Endpoint(ctx, Compute, failingToken{}); err != nil || got != "compute.example:443" {
+		t.Errorf("compute = %q, %v", got, err)
+	}
+
+	if got, err := Endpoint(ctx, Storage, tenantToken(t, "eu", "")); err != nil || got != "storage.example:443" {
+		t.Errorf("storage = %q, %v", got, err)
+	}
+}
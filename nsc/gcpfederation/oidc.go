@@ -12,6 +12,7 @@ import (
 
 	"namespacelabs.dev/integrations/api"
 	"namespacelabs.dev/integrations/nsc/apienv"
+	"namespacelabs.dev/integrations/nsc/telemetry"
 )
 
 func WithProduceOIDCWorkloadToken(authsrc api.TokenSource) func(context.Context, string) (string, error) {
@@ -39,7 +40,7 @@ func WithProduceOIDCWorkloadToken(authsrc api.TokenSource) func(context.Context,
 
 		log.Printf("Obtaining id_token")
 
-		httpResp, err := http.DefaultClient.Do(httpReq)
+		httpResp, err := telemetry.HTTPClient.Do(httpReq)
 		if err != nil {
 			return "", err
 		}
@@ -3,7 +3,6 @@ package grpcapi
 import (
 	"context"
 	"crypto/tls"
-	"encoding/json"
 	"fmt"
 	"io"
 	"net/url"
@@ -14,21 +13,31 @@ import (
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
 	"namespacelabs.dev/integrations/api"
-	"namespacelabs.dev/integrations/nsc"
+	"namespacelabs.dev/integrations/nsc/internal/version"
+	"namespacelabs.dev/integrations/nsc/telemetry"
 )
 
 // If set, emits requests and responses to this writer.
 // Note: debug writing relies on request interception.
+//
+// Deprecated: use WithLogging.
 var DebugWriter io.Writer
 
 // If set, shows request payloads in debug output.
+//
+// Deprecated: use WithLogging.
 var DebugShowRequests bool
 
 // If set, shows response payloads in debug output.
+//
+// Deprecated: use WithLogging.
 var DebugShowResponses bool
 
 // Tokens require TLS.
+//
+// Deprecated: use WithInsecure to send tokens to an insecure endpoint.
 var RequireTransportSecurity = true
 
 func NewConnectionWithEndpoint(ctx context.Context, endpoint string, token api.TokenSource, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
@@ -36,49 +45,58 @@ func NewConnectionWithEndpoint(ctx context.Context, endpoint string, token api.T
 }
 
 func NewConnectionWithEndpointWithTransportCredentials(ctx context.Context, endpoint string, token api.TokenSource, creds credentials.TransportCredentials, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
-	parsed, err := parseEndpoint(endpoint)
+	o := ParseOptions(opts...)
+
+	parsed, plaintext, err := parseEndpoint(endpoint, o.Insecure != nil)
 	if err != nil {
 		return nil, err
 	}
 
-	ourOpts := []grpc.DialOption{
-		grpc.WithUserAgent(fmt.Sprintf("nsc-go/%s", nsc.Version)),
-		grpc.WithTransportCredentials(creds),
+	if plaintext {
+		creds = insecure.NewCredentials()
 	}
 
-	if token != nil {
-		ourOpts = append(ourOpts, grpc.WithPerRPCCredentials(credWrapper{token}))
+	if o.TransportCredentials != nil {
+		creds = o.TransportCredentials
 	}
 
-	writer := DebugWriter
-	if writer == nil && boolean("NS_GRPC_DEBUG") {
-		writer = os.Stderr
+	userAgent := fmt.Sprintf("nsc-go/%s", version.Version)
+	if o.UserAgent != "" {
+		userAgent += " " + o.UserAgent
 	}
 
-	debugRequests := DebugShowRequests || boolean("NSC_GRPC_DEBUG_REQUESTS")
-	debugResponses := DebugShowResponses || boolean("NSC_GRPC_DEBUG_RESPONSES")
+	tel := &connTelemetry{endpoint: endpoint}
 
-	if writer != nil {
-		ourOpts = append(ourOpts, grpc.WithUnaryInterceptor(func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
-			fmt.Fprintf(writer, "[DEBUG] RPC request to: %s [%s]\n", method, endpoint)
+	ourOpts := []grpc.DialOption{
+		grpc.WithUserAgent(userAgent),
+		grpc.WithTransportCredentials(creds),
+		grpc.WithStatsHandler(telemetry.GRPCStatsHandler(endpoint)),
+		grpc.WithChainUnaryInterceptor(tel.unary),
+		grpc.WithChainStreamInterceptor(tel.stream),
+	}
 
-			if debugRequests {
-				b, _ := json.Marshal(req)
-				fmt.Fprintf(writer, "[DEBUG] Payload: %s\n", b)
-			}
+	// Tokens are only sent to insecure endpoints if the caller opted in.
+	if token != nil && (!plaintext || o.Insecure.SendTokens) {
+		ourOpts = append(ourOpts,
+			grpc.WithPerRPCCredentials(credWrapper{token, o.Insecure != nil && o.Insecure.SendTokens}),
+			grpc.WithChainUnaryInterceptor(reauth{tel}.unary),
+			grpc.WithChainStreamInterceptor(reauth{tel}.stream))
+	}
 
-			err := invoker(ctx, method, req, reply, cc, opts...)
-			if err == nil {
-				if debugResponses {
-					b, _ := json.Marshal(reply)
-					fmt.Fprintf(writer, "[DEBUG] Response Payload: %s\n", b)
-				}
-			} else {
-				fmt.Fprintf(writer, "[DEBUG] request failed: %v\n", err)
-			}
+	if o.RetryPolicy != nil {
+		ourOpts = append(ourOpts, retryPolicyOption{policy: *o.RetryPolicy}.interceptors()...)
+	}
 
-			return err
-		}))
+	logOpts, logEnabled := legacyLogOpts()
+	for _, opt := range opts {
+		if lo, ok := opt.(loggingOption); ok {
+			logOpts, logEnabled = lo.opts, true
+		}
+	}
+
+	// Installed last, so that retried calls are logged once per attempt.
+	if logEnabled && logOpts.Logger != nil {
+		ourOpts = append(ourOpts, callLogger{logOpts, endpoint}.interceptors()...)
 	}
 
 	return grpc.DialContext(ctx, parsed, append(ourOpts, opts...)...)
@@ -89,44 +107,84 @@ func boolean(env string) bool {
 	return b
 }
 
-func parseEndpoint(endpoint string) (string, error) {
-	if strings.HasPrefix(endpoint, "http://") {
-		return "", fmt.Errorf("http scheme not supported")
+// parseEndpoint returns the gRPC target of endpoint, and whether it's served
+// without TLS. Plaintext ("http://") and unix socket ("unix://") endpoints are
+// only accepted if allowInsecure is set.
+func parseEndpoint(endpoint string, allowInsecure bool) (string, bool, error) {
+	if strings.HasPrefix(endpoint, "unix:") {
+		if !allowInsecure {
+			return "", false, fmt.Errorf("unix socket endpoints require grpcapi.WithInsecure")
+		}
+
+		return endpoint, true, nil
 	}
 
-	if strings.HasPrefix(endpoint, "https://") {
-		u, err := url.Parse(endpoint)
+	if strings.HasPrefix(endpoint, "http://") {
+		if !allowInsecure {
+			return "", false, fmt.Errorf("http scheme not supported without grpcapi.WithInsecure")
+		}
+
+		u, err := parseURL(endpoint)
 		if err != nil {
-			return "", fmt.Errorf("invalid endpoint: %w", err)
+			return "", false, err
+		}
+
+		if u.Port() == "" {
+			return u.Host + ":80", true, nil
 		}
 
-		if strings.TrimPrefix(u.Path, "/") != "" {
-			return "", fmt.Errorf("path not supported: %q", u.Path)
+		return u.Host, true, nil
+	}
+
+	if strings.HasPrefix(endpoint, "https://") {
+		u, err := parseURL(endpoint)
+		if err != nil {
+			return "", false, err
 		}
 
-		return parseEndpoint(u.Host)
+		return parseEndpoint(u.Host, allowInsecure)
 	}
 
 	if strings.IndexByte(endpoint, ':') < 0 {
-		return endpoint + ":443", nil
+		return endpoint + ":443", false, nil
+	}
+
+	return endpoint, false, nil
+}
+
+func parseURL(endpoint string) (*url.URL, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint: %w", err)
 	}
 
-	return endpoint, nil
+	if strings.TrimPrefix(u.Path, "/") != "" {
+		return nil, fmt.Errorf("path not supported: %q", u.Path)
+	}
+
+	return u, nil
 }
 
 type credWrapper struct {
 	token api.TokenSource
+	// Set when the caller opted into sending tokens to an insecure endpoint.
+	allowInsecure bool
 }
 
 func (auth credWrapper) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
-	token, err := auth.token.IssueToken(ctx, 5*time.Minute, false)
+	token, err := auth.token.IssueToken(ctx, 5*time.Minute, forceRefresh(ctx))
 	if err != nil {
 		return nil, err
 	}
 
+	// Called within the call's span.
+	telemetry.AnnotateTenant(ctx, token)
+
 	return map[string]string{
 		"Authorization": "Bearer " + token,
 	}, nil
 }
 
-func (credWrapper) RequireTransportSecurity() bool { return RequireTransportSecurity }
+func (auth credWrapper) RequireTransportSecurity() bool {
+	return RequireTransportSecurity && !auth.allowInsecure
+}
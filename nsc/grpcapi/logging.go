@@ -0,0 +1,187 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"namespacelabs.dev/integrations/nsc/logging"
+)
+
+// LogOpts configures how a connection's calls are logged.
+type LogOpts struct {
+	// Calls are logged at debug level.
+	Logger *slog.Logger
+
+	// If set, request and response payloads are logged, with credentials
+	// redacted.
+	Requests, Responses bool
+}
+
+// WithLogging returns a dial option which logs every call of a connection, and
+// every message of its streams. It is recognized by the connections created by
+// this package, and so by all API clients.
+func WithLogging(opts LogOpts) grpc.DialOption {
+	return loggingOption{opts: opts}
+}
+
+type loggingOption struct {
+	grpc.EmptyDialOption
+	opts LogOpts
+}
+
+// legacyLogOpts returns the logging configured with DebugWriter and the
+// NS_GRPC_DEBUG environment variables, if any.
+func legacyLogOpts() (LogOpts, bool) {
+	writer := DebugWriter
+	if writer == nil && boolean("NS_GRPC_DEBUG") {
+		writer = os.Stderr
+	}
+
+	if writer == nil {
+		return LogOpts{}, false
+	}
+
+	return LogOpts{
+		Logger:    logging.FromWriter(writer),
+		Requests:  DebugShowRequests || boolean("NSC_GRPC_DEBUG_REQUESTS"),
+		Responses: DebugShowResponses || boolean("NSC_GRPC_DEBUG_RESPONSES"),
+	}, true
+}
+
+type callLogger struct {
+	opts     LogOpts
+	endpoint string
+}
+
+func (l callLogger) interceptors() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(l.unary),
+		grpc.WithChainStreamInterceptor(l.stream),
+	}
+}
+
+func (l callLogger) unary(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	log := l.opts.Logger.With("method", method, "endpoint", l.endpoint)
+
+	attrs := []any{}
+	if l.opts.Requests {
+		attrs = append(attrs, logging.Payload("request", req))
+	}
+
+	log.DebugContext(ctx, "RPC request", attrs...)
+
+	start := time.Now()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+
+	attrs = []any{"duration", time.Since(start)}
+	if err != nil {
+		attrs = append(attrs, "code", status.Code(err).String(), "error", err)
+		log.DebugContext(ctx, "RPC failed", attrs...)
+		return err
+	}
+
+	if l.opts.Responses {
+		attrs = append(attrs, logging.Payload("response", reply))
+	}
+
+	log.DebugContext(ctx, "RPC response", attrs...)
+	return nil
+}
+
+func (l callLogger) stream(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	log := l.opts.Logger.With("method", method, "endpoint", l.endpoint)
+
+	start := time.Now()
+	stream, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		log.DebugContext(ctx, "Stream failed to open", "code", status.Code(err).String(), "error", err)
+		return nil, err
+	}
+
+	log.DebugContext(ctx, "Stream opened", "client_streams", desc.ClientStreams, "server_streams", desc.ServerStreams)
+
+	return &loggingStream{ClientStream: stream, log: log, opts: l.opts, start: start}, nil
+}
+
+type loggingStream struct {
+	grpc.ClientStream
+	log   *slog.Logger
+	opts  LogOpts
+	start time.Time
+
+	mu       sync.Mutex
+	sent     int
+	received int
+	closed   bool
+}
+
+func (s *loggingStream) SendMsg(m any) error {
+	err := s.ClientStream.SendMsg(m)
+
+	s.mu.Lock()
+	s.sent++
+	n := s.sent
+	s.mu.Unlock()
+
+	attrs := []any{"seq", n}
+	if s.opts.Requests {
+		attrs = append(attrs, logging.Payload("message", m))
+	}
+
+	if err != nil {
+		attrs = append(attrs, "error", err)
+	}
+
+	s.log.DebugContext(s.Context(), "Stream sent", attrs...)
+	return err
+}
+
+func (s *loggingStream) CloseSend() error {
+	err := s.ClientStream.CloseSend()
+	s.log.DebugContext(s.Context(), "Stream closed for sending")
+	return err
+}
+
+func (s *loggingStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+
+	s.mu.Lock()
+	if err == nil {
+		s.received++
+	}
+	n, sent := s.received, s.sent
+	alreadyClosed := s.closed
+	if err != nil {
+		s.closed = true
+	}
+	s.mu.Unlock()
+
+	if err == nil {
+		attrs := []any{"seq", n}
+		if s.opts.Responses {
+			attrs = append(attrs, logging.Payload("message", m))
+		}
+
+		s.log.DebugContext(s.Context(), "Stream received", attrs...)
+		return nil
+	}
+
+	if !alreadyClosed {
+		attrs := []any{"duration", time.Since(s.start), "sent", sent, "received", n}
+		if errors.Is(err, io.EOF) {
+			s.log.DebugContext(s.Context(), "Stream ended", attrs...)
+		} else {
+			attrs = append(attrs, "code", status.Code(err).String(), "error", err)
+			s.log.DebugContext(s.Context(), "Stream failed", attrs...)
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,159 @@
+package grpcapi
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"namespacelabs.dev/integrations/api"
+)
+
+// Options are the settings accepted by every API client constructor. They're
+// passed as dial options, alongside any other grpc.DialOption, and apply
+// regardless of whether endpoints are overridden in the environment.
+type Options struct {
+	// The endpoint to connect to, set with WithEndpoint. It takes precedence
+	// over the client's default and over the environment.
+	Endpoint string
+	// Set with WithTransportCredentials. Defaults to TLS.
+	TransportCredentials credentials.TransportCredentials
+	// Appended to the SDK's user agent, set with WithUserAgent.
+	UserAgent string
+	// Set with WithLogger or WithLogging.
+	Logger *slog.Logger
+	// Used by clients which also make HTTP requests (e.g. storage), set with
+	// WithHTTPClient. Defaults to telemetry.HTTPClient.
+	HTTPClient *http.Client
+	// Set with WithRetryPolicy.
+	RetryPolicy *RetryPolicy
+	// Set with WithInsecure.
+	Insecure *InsecureOpts
+
+	// The options which aren't specific to this package.
+	DialOptions []grpc.DialOption
+}
+
+// WithEndpoint makes a client connect to endpoint.
+func WithEndpoint(endpoint string) grpc.DialOption {
+	return endpointOption{endpoint: endpoint}
+}
+
+// WithTransportCredentials replaces the default TLS transport credentials.
+func WithTransportCredentials(creds credentials.TransportCredentials) grpc.DialOption {
+	return transportCredsOption{creds: creds}
+}
+
+// InsecureOpts configures a connection to an insecure endpoint, e.g. a local
+// stand-in of an API in tests.
+type InsecureOpts struct {
+	// If set, bearer tokens are sent to the endpoint. Otherwise, calls are made
+	// without credentials.
+	SendTokens bool
+}
+
+// WithInsecure allows a connection to a plaintext ("http://host:port") or unix
+// socket ("unix:///path/to/socket") endpoint. Other endpoints keep using TLS.
+func WithInsecure(opts InsecureOpts) grpc.DialOption {
+	return insecureOption{opts: opts}
+}
+
+// WithUserAgent appends suffix to the user agent sent by a client, e.g. to
+// identify the integration which uses the SDK.
+func WithUserAgent(suffix string) grpc.DialOption {
+	return userAgentOption{suffix: suffix}
+}
+
+// WithLogger logs the calls of a client to l. It's a shorthand for
+// WithLogging without payloads.
+func WithLogger(l *slog.Logger) grpc.DialOption {
+	return WithLogging(LogOpts{Logger: l})
+}
+
+// WithHTTPClient sets the HTTP client used by clients which also make HTTP
+// requests.
+func WithHTTPClient(client *http.Client) grpc.DialOption {
+	return httpClientOption{client: client}
+}
+
+type endpointOption struct {
+	grpc.EmptyDialOption
+	endpoint string
+}
+
+type transportCredsOption struct {
+	grpc.EmptyDialOption
+	creds credentials.TransportCredentials
+}
+
+type insecureOption struct {
+	grpc.EmptyDialOption
+	opts InsecureOpts
+}
+
+type userAgentOption struct {
+	grpc.EmptyDialOption
+	suffix string
+}
+
+type httpClientOption struct {
+	grpc.EmptyDialOption
+	client *http.Client
+}
+
+// ParseOptions returns the Options set in opts. When an option is set more than
+// once, the last one wins.
+func ParseOptions(opts ...grpc.DialOption) Options {
+	var o Options
+	for _, opt := range opts {
+		switch x := opt.(type) {
+		case endpointOption:
+			o.Endpoint = x.endpoint
+		case transportCredsOption:
+			o.TransportCredentials = x.creds
+		case userAgentOption:
+			if o.UserAgent != "" {
+				o.UserAgent += " "
+			}
+			o.UserAgent += x.suffix
+		case loggingOption:
+			o.Logger = x.opts.Logger
+		case httpClientOption:
+			o.HTTPClient = x.client
+		case retryPolicyOption:
+			p := x.policy
+			o.RetryPolicy = &p
+		case insecureOption:
+			i := x.opts
+			o.Insecure = &i
+		default:
+			o.DialOptions = append(o.DialOptions, opt)
+		}
+	}
+
+	return o
+}
+
+// NewConnection connects to the endpoint set with WithEndpoint or, if there's
+// none, to the one returned by defaultEndpoint. It's used by the API clients'
+// constructors, which also get the parsed options.
+func NewConnection(ctx context.Context, token api.TokenSource, defaultEndpoint func() (string, error), opts ...grpc.DialOption) (*grpc.ClientConn, Options, error) {
+	o := ParseOptions(opts...)
+
+	endpoint := o.Endpoint
+	if endpoint == "" {
+		var err error
+		endpoint, err = defaultEndpoint()
+		if err != nil {
+			return nil, Options{}, err
+		}
+	}
+
+	conn, err := NewConnectionWithEndpoint(ctx, endpoint, token, opts...)
+	if err != nil {
+		return nil, Options{}, err
+	}
+
+	return conn, o, nil
+}
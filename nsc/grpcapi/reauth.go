@@ -0,0 +1,102 @@
+package grpcapi
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"namespacelabs.dev/integrations/nsc/telemetry"
+)
+
+type forceRefreshKey struct{}
+
+// withForceRefresh marks ctx so that credWrapper issues a new token, rather than
+// returning a cached one.
+func withForceRefresh(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forceRefreshKey{}, true)
+}
+
+func forceRefresh(ctx context.Context) bool {
+	v, _ := ctx.Value(forceRefreshKey{}).(bool)
+	return v
+}
+
+func isUnauthenticated(err error) bool {
+	return status.Code(err) == codes.Unauthenticated
+}
+
+// reauth retries calls which fail with Unauthenticated with a newly issued
+// token, and counts them in the connection's telemetry.
+type reauth struct {
+	tel *connTelemetry
+}
+
+func (r reauth) record(ctx context.Context, method, outcome string) {
+	telemetry.RecordReauthentication(ctx, outcome, r.tel.attrs(method)...)
+}
+
+// unary retries calls which fail with Unauthenticated once, with a newly
+// issued token. Cached tokens may have been revoked, or be considered expired
+// by the server due to clock skew.
+func (r reauth) unary(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	if !isUnauthenticated(err) {
+		return err
+	}
+
+	r.record(ctx, method, telemetry.ReauthRetried)
+
+	err = invoker(withForceRefresh(ctx), method, req, reply, cc, opts...)
+	if err == nil {
+		r.record(ctx, method, telemetry.ReauthRecovered)
+	}
+
+	return err
+}
+
+// stream retries streams which fail with Unauthenticated before any response
+// is received, once, with a newly issued token. See retryingStream for which
+// streams can be retried.
+func (r reauth) stream(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	stream, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		if !isUnauthenticated(err) {
+			return nil, err
+		}
+
+		r.record(ctx, method, telemetry.ReauthRetried)
+
+		stream, err = streamer(withForceRefresh(ctx), desc, cc, method, opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		r.record(ctx, method, telemetry.ReauthRecovered)
+		return stream, nil
+	}
+
+	retried := false
+	return &retryingStream{
+		ClientStream: stream,
+		retry: func(err error, replayable bool) (grpc.ClientStream, error) {
+			if !isUnauthenticated(err) || retried {
+				return nil, nil
+			}
+
+			if !replayable {
+				r.record(ctx, method, telemetry.ReauthNotRetried)
+				return nil, nil
+			}
+
+			retried = true
+			r.record(ctx, method, telemetry.ReauthRetried)
+			return streamer(withForceRefresh(ctx), desc, cc, method, opts...)
+		},
+		retried: func(err error) {
+			if !isUnauthenticated(err) {
+				r.record(ctx, method, telemetry.ReauthRecovered)
+			}
+		},
+	}, nil
+}
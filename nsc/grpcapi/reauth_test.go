@@ -0,0 +1,229 @@
+package grpcapi_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"namespacelabs.dev/integrations/nsc/grpcapi"
+	"namespacelabs.dev/integrations/nsc/telemetry"
+)
+
+// reauthMeter counts the reauthentications recorded through the global meter
+// provider, by method and outcome.
+type reauthMeter struct {
+	noop.Meter
+
+	mu     sync.Mutex
+	counts map[[2]string]int64
+}
+
+func (m *reauthMeter) Int64Counter(name string, _ ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	if name != "nsc.client.reauthentications" {
+		return noop.Int64Counter{}, nil
+	}
+
+	return reauthCounter{m: m}, nil
+}
+
+func (m *reauthMeter) count(method, outcome string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counts[[2]string{method, outcome}]
+}
+
+type reauthCounter struct {
+	noop.Int64Counter
+
+	m *reauthMeter
+}
+
+func (c reauthCounter) Add(_ context.Context, v int64, opts ...metric.AddOption) {
+	attrs := metric.NewAddConfig(opts).Attributes()
+	method, _ := attrs.Value(telemetry.OperationKey)
+	outcome, _ := attrs.Value(telemetry.ReauthOutcomeKey)
+
+	c.m.mu.Lock()
+	defer c.m.mu.Unlock()
+	c.m.counts[[2]string{method.AsString(), outcome.AsString()}] += v
+}
+
+type meterProvider struct {
+	noop.MeterProvider
+
+	meter *reauthMeter
+}
+
+func (p meterProvider) Meter(string, ...metric.MeterOption) metric.Meter {
+	return p.meter
+}
+
+var reauths = sync.OnceValue(func() *reauthMeter {
+	m := &reauthMeter{counts: map[[2]string]int64{}}
+	otel.SetMeterProvider(meterProvider{meter: m})
+	return m
+})
+
+// rotatingToken hands out a new token whenever a refresh is forced.
+type rotatingToken struct {
+	n atomic.Int32
+}
+
+func (t *rotatingToken) IssueToken(_ context.Context, _ time.Duration, force bool) (string, error) {
+	if force {
+		t.n.Add(1)
+	}
+
+	if t.n.Load() == 0 {
+		return "stale", nil
+	}
+
+	return "fresh", nil
+}
+
+// startAuthServer serves any method, rejecting calls made with the stale
+// token once the client has sent all of its messages.
+func startAuthServer(t *testing.T) *grpc.ClientConn {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(grpc.UnknownServiceHandler(func(_ any, stream grpc.ServerStream) error {
+		for {
+			if err := stream.RecvMsg(&emptypb.Empty{}); errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return err
+			}
+		}
+
+		md, _ := metadata.FromIncomingContext(stream.Context())
+		if auth := md.Get("authorization"); len(auth) == 0 || auth[0] != "Bearer fresh" {
+			return status.Error(codes.Unauthenticated, "token expired")
+		}
+
+		return stream.SendMsg(&emptypb.Empty{})
+	}))
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpcapi.NewConnectionWithEndpoint(context.Background(), "http://bufnet", &rotatingToken{},
+		grpcapi.WithInsecure(grpcapi.InsecureOpts{SendTokens: true}),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+// delta returns how many reauthentications of method with outcome are recorded
+// by the time the returned function is called.
+func (m *reauthMeter) delta(method, outcome string) func() int64 {
+	before := m.count(method, outcome)
+	return func() int64 { return m.count(method, outcome) - before }
+}
+
+func TestReauthUnary(t *testing.T) {
+	m := reauths()
+	conn := startAuthServer(t)
+
+	const method = "/test.Service/ReauthUnary"
+	retried, recovered := m.delta(method, telemetry.ReauthRetried), m.delta(method, telemetry.ReauthRecovered)
+
+	if err := invoke(conn, method); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := retried(); got != 1 {
+		t.Errorf("%d retries, want 1", got)
+	}
+
+	if got := recovered(); got != 1 {
+		t.Errorf("%d recoveries, want 1", got)
+	}
+}
+
+// stream sends msgs messages on a new stream of method, and receives its
+// response.
+func stream(t *testing.T, conn *grpc.ClientConn, method string, msgs int) error {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ClientStreams: true, ServerStreams: true}, method)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < msgs; i++ {
+		if err := stream.SendMsg(&emptypb.Empty{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+
+	return stream.RecvMsg(&emptypb.Empty{})
+}
+
+func TestReauthStream(t *testing.T) {
+	m := reauths()
+	conn := startAuthServer(t)
+
+	const method = "/test.Service/ReauthStream"
+	retried, recovered := m.delta(method, telemetry.ReauthRetried), m.delta(method, telemetry.ReauthRecovered)
+
+	if err := stream(t, conn, method, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := retried(); got != 1 {
+		t.Errorf("%d retries, want 1", got)
+	}
+
+	if got := recovered(); got != 1 {
+		t.Errorf("%d recoveries, want 1", got)
+	}
+}
+
+func TestReauthStreamNotRetried(t *testing.T) {
+	m := reauths()
+	conn := startAuthServer(t)
+
+	const method = "/test.Service/ReauthClientStream"
+	retried, notRetried := m.delta(method, telemetry.ReauthRetried), m.delta(method, telemetry.ReauthNotRetried)
+
+	// Streams which sent more than one message aren't replayed.
+	if err := stream(t, conn, method, 2); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("got %v, want Unauthenticated", err)
+	}
+
+	if got := notRetried(); got != 1 {
+		t.Errorf("%d streams not retried, want 1", got)
+	}
+
+	if got := retried(); got != 0 {
+		t.Errorf("%d retries, want 0", got)
+	}
+}
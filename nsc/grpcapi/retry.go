@@ -0,0 +1,219 @@
+package grpcapi
+
+import (
+	"context"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RetryPolicy determines which failed calls are retried, and how long to wait
+// in between. Pass it to any client's NewClient with WithRetryPolicy.
+type RetryPolicy struct {
+	// The maximum number of attempts, including the first one.
+	MaxAttempts int
+
+	// The delay before the first retry, which grows by Multiplier with each
+	// attempt, up to MaxBackoff. A random jitter of up to half the delay is
+	// applied.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+
+	// The status codes which are retried.
+	RetryableCodes []codes.Code
+
+	// Returns true for methods (e.g. "/namespace.cloud.compute.v1beta.ComputeService/GetUsage")
+	// which are safe to retry. A failed call may still have been processed by
+	// the server, so only methods without side effects should be retried
+	// blindly. Other methods are only retried when the server explicitly asks
+	// for a retry, with a RetryInfo detail.
+	Idempotent func(fullMethod string) bool
+}
+
+// DefaultRetryPolicy retries Unavailable and ResourceExhausted failures of
+// idempotent methods up to four times, starting with a 200ms backoff.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: 200 * time.Millisecond,
+		MaxBackoff:     10 * time.Second,
+		Multiplier:     2,
+		RetryableCodes: []codes.Code{codes.Unavailable, codes.ResourceExhausted},
+		Idempotent:     IsReadOnlyMethod,
+	}
+}
+
+var readOnlyPrefixes = []string{"Get", "List", "Describe", "Wait", "Fetch", "Check", "Resolve", "Stream", "Watch"}
+
+// IsReadOnlyMethod classifies methods by the verb their name starts with
+// (Get, List, Describe, Wait, etc).
+func IsReadOnlyMethod(fullMethod string) bool {
+	name := fullMethod[strings.LastIndexByte(fullMethod, '/')+1:]
+	for _, p := range readOnlyPrefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WithRetryPolicy returns a dial option which retries calls as determined by
+// policy. Zero fields of policy take their value from DefaultRetryPolicy.
+// Streams are retried if they fail before receiving a response, and sent at
+// most one message.
+//
+// The option is recognized by the connections created by this package, and so
+// by all API clients.
+func WithRetryPolicy(policy RetryPolicy) grpc.DialOption {
+	return retryPolicyOption{policy: policy.withDefaults()}
+}
+
+type retryPolicyOption struct {
+	grpc.EmptyDialOption
+	policy RetryPolicy
+}
+
+func (o retryPolicyOption) interceptors() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(o.policy.unary),
+		grpc.WithChainStreamInterceptor(o.policy.stream),
+	}
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	def := DefaultRetryPolicy()
+
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = def.MaxAttempts
+	}
+
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = def.InitialBackoff
+	}
+
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = def.MaxBackoff
+	}
+
+	if p.Multiplier < 1 {
+		p.Multiplier = def.Multiplier
+	}
+
+	if p.RetryableCodes == nil {
+		p.RetryableCodes = def.RetryableCodes
+	}
+
+	if p.Idempotent == nil {
+		p.Idempotent = def.Idempotent
+	}
+
+	return p
+}
+
+func (p RetryPolicy) unary(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	for attempt := 1; ; attempt++ {
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if err == nil {
+			return nil
+		}
+
+		if !p.wait(ctx, method, err, attempt) {
+			return err
+		}
+	}
+}
+
+func (p RetryPolicy) stream(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	attempt := 1
+	for {
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err == nil {
+			return &retryingStream{
+				ClientStream: stream,
+				retry: func(err error, replayable bool) (grpc.ClientStream, error) {
+					if !replayable || !p.wait(ctx, method, err, attempt) {
+						return nil, nil
+					}
+
+					attempt++
+					return streamer(ctx, desc, cc, method, opts...)
+				},
+			}, nil
+		}
+
+		if !p.wait(ctx, method, err, attempt) {
+			return nil, err
+		}
+
+		attempt++
+	}
+}
+
+// wait returns false if the call should not be retried after err, and
+// otherwise waits for the backoff before returning true.
+func (p RetryPolicy) wait(ctx context.Context, method string, err error, attempt int) bool {
+	if attempt >= p.MaxAttempts {
+		return false
+	}
+
+	st, _ := status.FromError(err)
+	if !slices.Contains(p.RetryableCodes, st.Code()) {
+		return false
+	}
+
+	delay, pushback := retryDelay(st)
+	if !pushback {
+		if !p.Idempotent(method) {
+			return false
+		}
+
+		delay = p.backoff(attempt)
+	}
+
+	// Don't wait for a retry that can't complete.
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		return false
+	}
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		d *= p.Multiplier
+	}
+
+	if d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+
+	return time.Duration(d/2 + rand.Float64()*d/2)
+}
+
+// retryDelay returns the delay the server asked for, if any.
+func retryDelay(st *status.Status) (time.Duration, bool) {
+	for _, d := range st.Details() {
+		if ri, ok := d.(*errdetails.RetryInfo); ok && ri.RetryDelay != nil {
+			return ri.RetryDelay.AsDuration(), true
+		}
+	}
+
+	return 0, false
+}
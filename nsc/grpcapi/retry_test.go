@@ -0,0 +1,257 @@
+package grpcapi_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"namespacelabs.dev/integrations/nsc/grpcapi"
+)
+
+// flakyServer fails the first failures calls of each method with err, and
+// counts the calls it receives.
+type flakyServer struct {
+	failures int
+	err      func() error
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (s *flakyServer) handle(_ any, stream grpc.ServerStream) error {
+	method, _ := grpc.MethodFromServerStream(stream)
+
+	s.mu.Lock()
+	s.calls[method]++
+	n := s.calls[method]
+	s.mu.Unlock()
+
+	if err := stream.RecvMsg(&emptypb.Empty{}); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	if n <= s.failures {
+		return s.err()
+	}
+
+	return stream.SendMsg(&emptypb.Empty{})
+}
+
+func (s *flakyServer) count(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[method]
+}
+
+func startFlakyServer(t *testing.T, failures int, err func() error) (*flakyServer, *grpc.ClientConn) {
+	t.Helper()
+
+	s := &flakyServer{failures: failures, err: err, calls: map[string]int{}}
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(grpc.UnknownServiceHandler(s.handle))
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, dialErr := grpcapi.NewConnectionWithEndpoint(context.Background(), "http://bufnet", nil,
+		grpcapi.WithInsecure(grpcapi.InsecureOpts{}),
+		grpcapi.WithRetryPolicy(grpcapi.RetryPolicy{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     5 * time.Millisecond,
+		}),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}))
+	if dialErr != nil {
+		t.Fatal(dialErr)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+
+	return s, conn
+}
+
+func unavailable() error {
+	return status.Error(codes.Unavailable, "try again")
+}
+
+func invoke(conn *grpc.ClientConn, method string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return conn.Invoke(ctx, method, &emptypb.Empty{}, &emptypb.Empty{})
+}
+
+func TestRetryIdempotent(t *testing.T) {
+	s, conn := startFlakyServer(t, 2, unavailable)
+
+	const method = "/test.Service/GetThing"
+	if err := invoke(conn, method); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := s.count(method); got != 3 {
+		t.Errorf("%d attempts, want 3", got)
+	}
+}
+
+func TestRetryMaxAttempts(t *testing.T) {
+	s, conn := startFlakyServer(t, 5, unavailable)
+
+	const method = "/test.Service/ListThings"
+	if err := invoke(conn, method); status.Code(err) != codes.Unavailable {
+		t.Fatalf("got %v, want Unavailable", err)
+	}
+
+	if got := s.count(method); got != 3 {
+		t.Errorf("%d attempts, want 3", got)
+	}
+}
+
+func TestRetryNonIdempotent(t *testing.T) {
+	s, conn := startFlakyServer(t, 1, unavailable)
+
+	const method = "/test.Service/CreateThing"
+	if err := invoke(conn, method); status.Code(err) != codes.Unavailable {
+		t.Fatalf("got %v, want Unavailable", err)
+	}
+
+	if got := s.count(method); got != 1 {
+		t.Errorf("%d attempts, want 1", got)
+	}
+}
+
+func TestRetryNonRetryableCode(t *testing.T) {
+	s, conn := startFlakyServer(t, 1, func() error {
+		return status.Error(codes.NotFound, "no such thing")
+	})
+
+	const method = "/test.Service/GetThing"
+	if err := invoke(conn, method); status.Code(err) != codes.NotFound {
+		t.Fatalf("got %v, want NotFound", err)
+	}
+
+	if got := s.count(method); got != 1 {
+		t.Errorf("%d attempts, want 1", got)
+	}
+}
+
+func TestRetryServerPushback(t *testing.T) {
+	s, conn := startFlakyServer(t, 1, func() error {
+		st, err := status.New(codes.Unavailable, "try again").WithDetails(&errdetails.RetryInfo{
+			RetryDelay: durationpb.New(time.Millisecond),
+		})
+		if err != nil {
+			return err
+		}
+
+		return st.Err()
+	})
+
+	// Non-idempotent methods are retried when the server asks for it.
+	const method = "/test.Service/CreateThing"
+	if err := invoke(conn, method); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := s.count(method); got != 2 {
+		t.Errorf("%d attempts, want 2", got)
+	}
+}
+
+func TestRetryStream(t *testing.T) {
+	s, conn := startFlakyServer(t, 2, unavailable)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	const method = "/test.Service/WatchThings"
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, method)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := stream.SendMsg(&emptypb.Empty{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := stream.RecvMsg(&emptypb.Empty{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := s.count(method); got != 3 {
+		t.Errorf("%d attempts, want 3", got)
+	}
+}
+
+func TestRetryStreamBackoffUnlocked(t *testing.T) {
+	const backoff = 500 * time.Millisecond
+
+	s, conn := startFlakyServer(t, 1, func() error {
+		st, err := status.New(codes.Unavailable, "try again").WithDetails(&errdetails.RetryInfo{
+			RetryDelay: durationpb.New(backoff),
+		})
+		if err != nil {
+			return err
+		}
+
+		return st.Err()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	const method = "/test.Service/WatchThings"
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, method)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := stream.SendMsg(&emptypb.Empty{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- stream.RecvMsg(&emptypb.Empty{}) }()
+
+	for s.count(method) < 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	// The stream remains usable while the retry backs off.
+	_ = stream.Context()
+	if elapsed := time.Since(start); elapsed >= backoff {
+		t.Errorf("Context() blocked for the retry's backoff (%v)", elapsed)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if got := s.count(method); got != 2 {
+		t.Errorf("%d attempts, want 2", got)
+	}
+}
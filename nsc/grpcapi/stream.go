@@ -0,0 +1,146 @@
+package grpcapi
+
+import (
+	"context"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// retryingStream re-opens a stream when receiving fails before any response
+// was received. To keep from buffering arbitrary amounts of data, only streams
+// which sent at most one message (e.g. server-streaming calls) are replayed
+// onto the new stream.
+type retryingStream struct {
+	grpc.ClientStream
+
+	// Called when receiving fails before any response was received. Returns
+	// the stream to replay onto, or nil if err should be returned. replayable
+	// is false if the stream can't be replayed, and must not be retried.
+	retry func(err error, replayable bool) (grpc.ClientStream, error)
+	// If set, called with the outcome of the first receive after a retry.
+	retried func(err error)
+
+	mu         sync.Mutex
+	sent       []any
+	sentCount  int
+	closedSend bool
+	received   bool
+}
+
+func (s *retryingStream) current() grpc.ClientStream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ClientStream
+}
+
+// SendMsg and RecvMsg may be called concurrently, and sending may block on
+// flow control, so the lock is not held while calling into the stream.
+
+func (s *retryingStream) SendMsg(m any) error {
+	s.mu.Lock()
+	s.sentCount++
+	if s.sentCount == 1 {
+		s.sent = append(s.sent, m)
+	} else {
+		s.sent = nil
+	}
+	stream := s.ClientStream
+	s.mu.Unlock()
+
+	return stream.SendMsg(m)
+}
+
+func (s *retryingStream) CloseSend() error {
+	s.mu.Lock()
+	s.closedSend = true
+	stream := s.ClientStream
+	s.mu.Unlock()
+
+	return stream.CloseSend()
+}
+
+func (s *retryingStream) Header() (metadata.MD, error) {
+	return s.current().Header()
+}
+
+func (s *retryingStream) Trailer() metadata.MD {
+	return s.current().Trailer()
+}
+
+func (s *retryingStream) Context() context.Context {
+	return s.current().Context()
+}
+
+// RecvMsg retries without holding the lock, as retrying may back off. Messages
+// sent concurrently go to the failed stream; if any were, the new stream is
+// not used.
+func (s *retryingStream) RecvMsg(m any) error {
+	err := s.current().RecvMsg(m)
+
+	for err != nil {
+		s.mu.Lock()
+		received, sent, sentCount, closedSend := s.received, s.sent, s.sentCount, s.closedSend
+		s.mu.Unlock()
+
+		if received {
+			return err
+		}
+
+		stream, retryErr := s.retry(err, sentCount <= 1)
+		if stream == nil {
+			if retryErr != nil {
+				return retryErr
+			}
+
+			return err
+		}
+
+		if replayErr := replay(stream, sent, closedSend); replayErr != nil {
+			err = replayErr
+			continue
+		}
+
+		s.mu.Lock()
+		if s.sentCount != sentCount {
+			s.mu.Unlock()
+			return err
+		}
+
+		s.ClientStream = stream
+		closeSend := s.closedSend && !closedSend
+		s.mu.Unlock()
+
+		if closeSend {
+			if err = stream.CloseSend(); err != nil {
+				continue
+			}
+		}
+
+		err = stream.RecvMsg(m)
+		if s.retried != nil {
+			s.retried(err)
+		}
+	}
+
+	s.mu.Lock()
+	s.received = true
+	s.mu.Unlock()
+
+	return nil
+}
+
+func replay(stream grpc.ClientStream, sent []any, closeSend bool) error {
+	for _, m := range sent {
+		if err := stream.SendMsg(m); err != nil {
+			return err
+		}
+	}
+
+	if closeSend {
+		return stream.CloseSend()
+	}
+
+	return nil
+}
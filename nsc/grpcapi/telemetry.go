@@ -0,0 +1,39 @@
+package grpcapi
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/grpc"
+	"namespacelabs.dev/integrations/nsc/telemetry"
+)
+
+// connTelemetry records the metrics of a connection's calls.
+type connTelemetry struct {
+	endpoint string
+}
+
+func (t *connTelemetry) attrs(method string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		telemetry.TransportKey.String("grpc"),
+		telemetry.OperationKey.String(method),
+		telemetry.EndpointKey.String(t.endpoint),
+	}
+}
+
+func (t *connTelemetry) unary(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	start := time.Now()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	telemetry.Record(ctx, start, err, t.attrs(method)...)
+	return err
+}
+
+// stream only records failures to establish streams; their duration is up to
+// the caller.
+func (t *connTelemetry) stream(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	start := time.Now()
+	stream, err := streamer(ctx, desc, cc, method, opts...)
+	telemetry.Record(ctx, start, err, t.attrs(method)...)
+	return stream, err
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"log/slog"
 	"net"
 	"net/http"
 	"net/url"
@@ -12,19 +13,34 @@ import (
 	computev1beta "buf.build/gen/go/namespace/cloud/protocolbuffers/go/proto/namespace/cloud/compute/v1beta"
 	"github.com/gorilla/websocket"
 	"github.com/jpillora/chisel/share/cnet"
+	"go.opentelemetry.io/otel/attribute"
 	"namespacelabs.dev/go-ids"
 	"namespacelabs.dev/integrations/api"
+	"namespacelabs.dev/integrations/nsc/logging"
+	"namespacelabs.dev/integrations/nsc/telemetry"
 )
 
+// Dialer dials services exposed through the Namespace ingress gateway.
+type Dialer struct {
+	Token api.TokenSource
+	// If set, dials are logged at debug level.
+	Logger *slog.Logger
+}
+
+// DialEndpoint dials endpoint, using debugLog for debug output.
 func DialEndpoint(ctx context.Context, debugLog io.Writer, token api.TokenSource, endpoint string) (net.Conn, error) {
-	tid := ids.NewRandomBase32ID(4)
-	fmt.Fprintf(debugLog, "[%s] Gateway: dialing %v...\n", tid, endpoint)
+	return Dialer{Token: token, Logger: logging.FromWriter(debugLog)}.DialEndpoint(ctx, endpoint)
+}
+
+func (dl Dialer) DialEndpoint(ctx context.Context, endpoint string) (net.Conn, error) {
+	log := logging.OrDiscard(dl.Logger).With("conn_id", ids.NewRandomBase32ID(4), "endpoint", endpoint)
+	log.DebugContext(ctx, "Gateway: dialing")
 
 	d := websocket.Dialer{
 		HandshakeTimeout: 15 * time.Second,
 	}
 
-	bt, err := token.IssueToken(ctx, 5*time.Minute, false)
+	bt, err := dl.Token.IssueToken(ctx, 5*time.Minute, false)
 	if err != nil {
 		return nil, err
 	}
@@ -32,19 +48,33 @@ func DialEndpoint(ctx context.Context, debugLog io.Writer, token api.TokenSource
 	hdrs := http.Header{}
 	hdrs.Add("Authorization", "Bearer "+bt)
 
+	attrs := []attribute.KeyValue{
+		telemetry.TransportKey.String("websocket"),
+		telemetry.OperationKey.String("dial"),
+		telemetry.EndpointKey.String(endpoint),
+	}
+
+	ctx, done := telemetry.StartSpan(ctx, "Gateway dial", attrs...)
+	telemetry.AnnotateTenant(ctx, bt)
+
 	t := time.Now()
 	wsConn, _, err := d.DialContext(ctx, endpoint, hdrs)
+	done(err)
 	if err != nil {
-		fmt.Fprintf(debugLog, "[%s] Gateway: %v: failed: %v\n", tid, endpoint, err)
+		log.DebugContext(ctx, "Gateway: dial failed", "error", err)
 		return nil, err
 	}
 
-	fmt.Fprintf(debugLog, "[%s] Gateway: dialing %v... took %v\n", tid, endpoint, time.Since(t))
+	log.DebugContext(ctx, "Gateway: dialed", "duration", time.Since(t))
 
 	return cnet.NewWebSocketConn(wsConn), nil
 }
 
 func DialHostedService(ctx context.Context, debugLog io.Writer, token api.TokenSource, instanceId, ingressDomain, serviceName string, vars url.Values) (net.Conn, error) {
+	return Dialer{Token: token, Logger: logging.FromWriter(debugLog)}.DialHostedService(ctx, instanceId, ingressDomain, serviceName, vars)
+}
+
+func (dl Dialer) DialHostedService(ctx context.Context, instanceId, ingressDomain, serviceName string, vars url.Values) (net.Conn, error) {
 	u := url.URL{
 		Scheme:   "wss",
 		Host:     fmt.Sprintf("gate.%s", ingressDomain),
@@ -52,19 +82,27 @@ func DialHostedService(ctx context.Context, debugLog io.Writer, token api.TokenS
 		RawQuery: vars.Encode(),
 	}
 
-	return DialEndpoint(ctx, debugLog, token, u.String())
+	return dl.DialEndpoint(ctx, u.String())
 }
 
 func DialNamedUnixSocket(ctx context.Context, debugLog io.Writer, token api.TokenSource, metadata *computev1beta.InstanceMetadata, name string) (net.Conn, error) {
+	return Dialer{Token: token, Logger: logging.FromWriter(debugLog)}.DialNamedUnixSocket(ctx, metadata, name)
+}
+
+func (dl Dialer) DialNamedUnixSocket(ctx context.Context, metadata *computev1beta.InstanceMetadata, name string) (net.Conn, error) {
 	vars := url.Values{}
 	vars.Set("name", name)
-	return DialHostedService(ctx, debugLog, token, metadata.InstanceId, metadata.IngressDomain, "unixsocket", vars)
+	return dl.DialHostedService(ctx, metadata.InstanceId, metadata.IngressDomain, "unixsocket", vars)
 }
 
 func DialInstanceService(ctx context.Context, debugLog io.Writer, token api.TokenSource, metadata *computev1beta.InstanceMetadata, serviceName string) (net.Conn, error) {
+	return Dialer{Token: token, Logger: logging.FromWriter(debugLog)}.DialInstanceService(ctx, metadata, serviceName)
+}
+
+func (dl Dialer) DialInstanceService(ctx context.Context, metadata *computev1beta.InstanceMetadata, serviceName string) (net.Conn, error) {
 	for _, srv := range metadata.Services {
 		if srv.Name == serviceName {
-			return DialEndpoint(ctx, debugLog, token, srv.Endpoint)
+			return dl.DialEndpoint(ctx, srv.Endpoint)
 		}
 	}
 
@@ -0,0 +1,5 @@
+// Package version holds the SDK version, so that it can be used by the
+// packages which package nsc depends on.
+package version
+
+const Version = "1"
@@ -0,0 +1,84 @@
+// Package jsonapi calls Namespace API methods which are served as JSON over
+// HTTP, rather than through the public gRPC services.
+package jsonapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"namespacelabs.dev/integrations/nsc/telemetry"
+)
+
+// Call POSTs req as JSON to method (e.g. "nsl.tenants.TenantsService/IssueIdToken")
+// at endpoint, and decodes the response into resp. If bearer is set, it is
+// sent as the request's bearer token. A nil client uses telemetry.HTTPClient.
+func Call(ctx context.Context, client *http.Client, endpoint, method, bearer string, req, resp any) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal body: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", strings.TrimSuffix(endpoint, "/")+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	if bearer != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+bearer)
+	}
+
+	return Do(client, httpReq, resp)
+}
+
+// Error is returned when the server responds with a non-OK status.
+type Error struct {
+	StatusCode int
+	// The gRPC status code, if the server reported one.
+	Code    codes.Code
+	Message string
+}
+
+func (e *Error) Error() string { return e.Message }
+
+func (e *Error) GRPCStatus() *status.Status { return status.New(e.Code, e.Message) }
+
+// Do sends req and decodes its JSON response into resp.
+func Do(client *http.Client, req *http.Request, resp any) error {
+	if client == nil {
+		client = telemetry.HTTPClient
+	}
+
+	httpResp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		err := &Error{StatusCode: httpResp.StatusCode, Code: codes.Unknown}
+		if code, convErr := strconv.Atoi(httpResp.Header.Get("grpc-status")); convErr == nil {
+			err.Code = codes.Code(code)
+		}
+
+		if msg := httpResp.Header.Get("grpc-message"); msg != "" {
+			err.Message = msg
+		} else {
+			output, _ := io.ReadAll(httpResp.Body)
+			err.Message = fmt.Sprintf("failed with status: %v\n%s", httpResp.Status, output)
+		}
+
+		return err
+	}
+
+	return json.NewDecoder(httpResp.Body).Decode(resp)
+}
@@ -0,0 +1,146 @@
+// Package logging provides the helpers the SDK uses to emit debug logs through
+// log/slog, and to redact credentials from the payloads it logs.
+//
+// SDK entry points accept a *slog.Logger; a nil logger disables logging.
+// Debug events are logged at slog.LevelDebug.
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const redacted = "[REDACTED]"
+
+// Discard is a logger which drops everything.
+var Discard = slog.New(slog.DiscardHandler)
+
+// OrDiscard returns l, or Discard if l is nil.
+func OrDiscard(l *slog.Logger) *slog.Logger {
+	if l == nil {
+		return Discard
+	}
+
+	return l
+}
+
+// FromWriter returns a logger which writes debug logs as text to w, for
+// functions which take a debug log io.Writer. A nil w, or io.Discard, discards
+// logs.
+func FromWriter(w io.Writer) *slog.Logger {
+	if w == nil || w == io.Discard {
+		return Discard
+	}
+
+	return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+// Printf returns a printf-style function which logs to l, e.g. for
+// netcopy.DebugLogFunc.
+func Printf(l *slog.Logger, attrs ...any) func(string, ...any) {
+	l = OrDiscard(l).With(attrs...)
+	return func(format string, args ...any) {
+		l.Debug(fmt.Sprintf(format, args...))
+	}
+}
+
+// Payload returns an attribute with the JSON representation of v, with
+// credentials redacted. Protobuf messages are rendered with their proto field
+// names.
+func Payload(key string, v any) slog.Attr {
+	var b []byte
+	var err error
+	if m, ok := v.(proto.Message); ok {
+		b, err = protojson.MarshalOptions{UseProtoNames: true}.Marshal(m)
+	} else {
+		b, err = json.Marshal(v)
+	}
+
+	if err != nil {
+		return slog.String(key, "<unserializable: "+err.Error()+">")
+	}
+
+	return slog.String(key, string(RedactJSON(b)))
+}
+
+// RedactJSON replaces the values of fields which hold credentials (e.g.
+// bearer_token, private_key_pem, password), and any string which looks like a
+// Namespace token or a PEM private key.
+func RedactJSON(b []byte) []byte {
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return []byte(RedactString(string(b)))
+	}
+
+	out, err := json.Marshal(redact(v))
+	if err != nil {
+		return []byte(redacted)
+	}
+
+	return out
+}
+
+var (
+	tokenPattern = regexp.MustCompile(`\b(st|nsct|nscw|cognito)_[A-Za-z0-9._\-]+`)
+	pemPattern   = regexp.MustCompile(`(?s)-----BEGIN [A-Z ]*PRIVATE KEY-----.*?-----END [A-Z ]*PRIVATE KEY-----`)
+	bearerRegexp = regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._\-]+`)
+)
+
+// RedactString replaces anything in s which looks like a Namespace token, a
+// bearer token, or a PEM private key.
+func RedactString(s string) string {
+	s = pemPattern.ReplaceAllString(s, redacted)
+	s = bearerRegexp.ReplaceAllString(s, "Bearer "+redacted)
+	return tokenPattern.ReplaceAllString(s, "${1}_"+redacted)
+}
+
+func redact(v any) any {
+	switch x := v.(type) {
+	case map[string]any:
+		for k, fv := range x {
+			if sensitiveKey(k) {
+				if s, ok := fv.(string); !ok || s != "" {
+					x[k] = redacted
+				}
+
+				continue
+			}
+
+			x[k] = redact(fv)
+		}
+
+		return x
+
+	case []any:
+		for i := range x {
+			x[i] = redact(x[i])
+		}
+
+		return x
+
+	case string:
+		return RedactString(x)
+
+	default:
+		return v
+	}
+}
+
+// sensitiveKey matches e.g. bearer_token, session_token, id_token,
+// private_key_pem and password, but not token_id.
+func sensitiveKey(k string) bool {
+	k = strings.ToLower(strings.ReplaceAll(k, "-", "_"))
+
+	return strings.HasSuffix(k, "token") ||
+		k == "authorization" ||
+		strings.Contains(k, "private_key") ||
+		strings.Contains(k, "privatekey") ||
+		strings.Contains(k, "password")
+}
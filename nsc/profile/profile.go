@@ -0,0 +1,302 @@
+// Package profile manages named sets of user credentials and endpoint
+// overrides in the user's configuration directory.
+//
+// The "default" profile lives directly in <UserConfigDir>/ns, where `nsc login`
+// leaves its token. Other profiles live in <UserConfigDir>/ns/profiles/<name>.
+// Each profile directory holds its own token.json, token cache and an
+// optional profile.json with endpoint overrides.
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"namespacelabs.dev/integrations/internal/fsutil"
+)
+
+const (
+	Default = "default"
+
+	profilesDir = "profiles"
+	currentFile = "current_profile"
+	profileFile = "profile.json"
+)
+
+var validName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+type Profile struct {
+	Name string `json:"-"`
+
+	// Endpoint overrides. Environment variables take precedence over these.
+	GlobalEndpoint  string `json:"global_endpoint,omitempty"`
+	IAMEndpoint     string `json:"iam_endpoint,omitempty"`
+	ComputeEndpoint string `json:"compute_endpoint,omitempty"`
+	StorageEndpoint string `json:"storage_endpoint,omitempty"`
+}
+
+// ConfigDir returns the directory where Namespace keeps user configuration.
+func ConfigDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return dir, err
+	}
+
+	return filepath.Join(dir, "ns"), nil
+}
+
+// Active returns the name of the selected profile: NSC_PROFILE if set,
+// otherwise the profile last switched to, or the default profile.
+//
+// The active profile is resolved once, and again only after Switch, Add or
+// Remove, or when NSC_PROFILE or the configuration directory change. This keeps
+// credentials and endpoint overrides (see nsc/apienv) from being taken from
+// different profiles.
+func Active() string {
+	name, _, _ := resolveActive()
+	return name
+}
+
+var active struct {
+	sync.Mutex
+	key     string
+	valid   bool
+	name    string
+	profile Profile
+	err     error
+}
+
+func resolveActive() (string, Profile, error) {
+	dir, _ := ConfigDir()
+	key := dir + "\x00" + os.Getenv("NSC_PROFILE")
+
+	active.Lock()
+	defer active.Unlock()
+
+	if !active.valid || active.key != key {
+		active.name = activeName(dir)
+		active.profile, active.err = Load(active.name)
+		active.key, active.valid = key, true
+	}
+
+	return active.name, active.profile, active.err
+}
+
+func invalidateActive() {
+	active.Lock()
+	defer active.Unlock()
+
+	active.valid = false
+}
+
+func activeName(dir string) string {
+	if p := os.Getenv("NSC_PROFILE"); p != "" {
+		return p
+	}
+
+	if dir == "" {
+		return Default
+	}
+
+	contents, err := os.ReadFile(filepath.Join(dir, currentFile))
+	if err != nil {
+		return Default
+	}
+
+	if name := strings.TrimSpace(string(contents)); name != "" {
+		return name
+	}
+
+	return Default
+}
+
+// Dir returns the directory which holds the profile's files.
+func Dir(name string) (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	if name == "" || name == Default {
+		return dir, nil
+	}
+
+	if !validName.MatchString(name) {
+		return "", fmt.Errorf("invalid profile name %q", name)
+	}
+
+	return filepath.Join(dir, profilesDir, name), nil
+}
+
+// Load returns the profile's configuration. Profiles without endpoint
+// overrides have an empty configuration.
+func Load(name string) (Profile, error) {
+	if name == "" {
+		name = Default
+	}
+
+	dir, err := Dir(name)
+	if err != nil {
+		return Profile{}, err
+	}
+
+	if name != Default {
+		if _, err := os.Stat(dir); err != nil {
+			if os.IsNotExist(err) {
+				return Profile{}, fmt.Errorf("no such profile %q", name)
+			}
+
+			return Profile{}, err
+		}
+	}
+
+	p := Profile{Name: name}
+
+	contents, err := os.ReadFile(filepath.Join(dir, profileFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return p, nil
+		}
+
+		return Profile{}, err
+	}
+
+	if err := json.Unmarshal(contents, &p); err != nil {
+		return Profile{}, fmt.Errorf("failed to parse profile %q: %w", name, err)
+	}
+
+	return p, nil
+}
+
+// LoadActive returns the configuration of the active profile.
+func LoadActive() (Profile, error) {
+	_, p, err := resolveActive()
+	return p, err
+}
+
+// List returns the names of all profiles, including the default one.
+func List() ([]string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{Default}
+
+	entries, err := os.ReadDir(filepath.Join(dir, profilesDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return names, nil
+		}
+
+		return nil, err
+	}
+
+	for _, e := range entries {
+		if e.IsDir() && validName.MatchString(e.Name()) && e.Name() != Default {
+			names = append(names, e.Name())
+		}
+	}
+
+	sort.Strings(names[1:])
+	return names, nil
+}
+
+// Add creates a profile, or updates the endpoint overrides of an existing one.
+func Add(p Profile) error {
+	dir, err := Dir(p.Name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	contents, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	defer invalidateActive()
+
+	return fsutil.WriteFileAtomic(filepath.Join(dir, profileFile), contents, 0600)
+}
+
+// Remove deletes a profile, including its credentials. The default profile
+// can't be removed.
+func Remove(name string) error {
+	if name == "" || name == Default {
+		return errors.New("the default profile can't be removed")
+	}
+
+	dir, err := Dir(name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(dir); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("no such profile %q", name)
+		}
+
+		return err
+	}
+
+	defer invalidateActive()
+
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+
+	if current, err := currentPath(); err == nil {
+		if contents, err := os.ReadFile(current); err == nil && strings.TrimSpace(string(contents)) == name {
+			return os.Remove(current)
+		}
+	}
+
+	return nil
+}
+
+// Switch makes name the active profile when NSC_PROFILE is not set.
+func Switch(name string) error {
+	current, err := currentPath()
+	if err != nil {
+		return err
+	}
+
+	defer invalidateActive()
+
+	if name == "" || name == Default {
+		if err := os.Remove(current); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		return nil
+	}
+
+	if _, err := Load(name); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(current), 0700); err != nil {
+		return err
+	}
+
+	return os.WriteFile(current, []byte(name+"\n"), 0600)
+}
+
+func currentPath() (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, currentFile), nil
+}
@@ -0,0 +1,177 @@
+package profile_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"namespacelabs.dev/integrations/nsc/apienv"
+	"namespacelabs.dev/integrations/nsc/profile"
+)
+
+func setup(t *testing.T) string {
+	t.Helper()
+
+	config := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", config)
+	t.Setenv("NSC_PROFILE", "")
+	t.Setenv("NSC_ENDPOINT", "")
+
+	return filepath.Join(config, "ns")
+}
+
+func TestAddListRemove(t *testing.T) {
+	dir := setup(t)
+
+	if got, err := profile.List(); err != nil || !reflect.DeepEqual(got, []string{profile.Default}) {
+		t.Fatalf("List() = %v, %v", got, err)
+	}
+
+	for _, p := range []profile.Profile{
+		{Name: "staging", ComputeEndpoint: "https://compute.staging.example"},
+		{Name: "dev"},
+	} {
+		if err := profile.Add(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, err := profile.List(); err != nil || !reflect.DeepEqual(got, []string{profile.Default, "dev", "staging"}) {
+		t.Fatalf("List() = %v, %v", got, err)
+	}
+
+	p, err := profile.Load("staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Name != "staging" || p.ComputeEndpoint != "https://compute.staging.example" {
+		t.Errorf("Load(staging) = %+v", p)
+	}
+
+	// Updating a profile replaces its overrides, without leaving temporary
+	// files behind.
+	if err := profile.Add(profile.Profile{Name: "staging", IAMEndpoint: "https://iam.staging.example"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if p, err := profile.Load("staging"); err != nil || p.ComputeEndpoint != "" || p.IAMEndpoint != "https://iam.staging.example" {
+		t.Errorf("Load(staging) = %+v, %v", p, err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, "profiles", "staging"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 || entries[0].Name() != "profile.json" {
+		t.Errorf("unexpected files: %v", entries)
+	}
+
+	if err := profile.Remove("staging"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := profile.Load("staging"); err == nil {
+		t.Error("Load succeeded for a removed profile")
+	}
+
+	if err := profile.Remove("staging"); err == nil {
+		t.Error("removing a missing profile succeeded")
+	}
+
+	if err := profile.Remove(profile.Default); err == nil {
+		t.Error("removing the default profile succeeded")
+	}
+}
+
+func TestInvalidNames(t *testing.T) {
+	setup(t)
+
+	for _, name := range []string{"../escape", "a/b", ".hidden", "-flag", "with space"} {
+		if err := profile.Add(profile.Profile{Name: name}); err == nil {
+			t.Errorf("Add(%q) succeeded", name)
+		}
+
+		if _, err := profile.Dir(name); err == nil {
+			t.Errorf("Dir(%q) succeeded", name)
+		}
+
+		if err := profile.Switch(name); err == nil {
+			t.Errorf("Switch(%q) succeeded", name)
+		}
+	}
+}
+
+func TestSwitch(t *testing.T) {
+	setup(t)
+
+	if got := profile.Active(); got != profile.Default {
+		t.Fatalf("Active() = %q", got)
+	}
+
+	if err := profile.Switch("missing"); err == nil {
+		t.Fatal("switching to a missing profile succeeded")
+	}
+
+	if err := profile.Add(profile.Profile{Name: "staging", ComputeEndpoint: "https://compute.staging.example"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := profile.Switch("staging"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Credentials and endpoint overrides follow a switch within the process.
+	if got := profile.Active(); got != "staging" {
+		t.Errorf("Active() = %q, want staging", got)
+	}
+
+	if got := apienv.ComputeEndpoint(); got != "https://compute.staging.example" {
+		t.Errorf("ComputeEndpoint() = %q", got)
+	}
+
+	if err := profile.Switch(profile.Default); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := profile.Active(); got != profile.Default {
+		t.Errorf("Active() = %q, want the default profile", got)
+	}
+
+	if got := apienv.ComputeEndpoint(); got != apienv.DefaultComputeEndpoint {
+		t.Errorf("ComputeEndpoint() = %q", got)
+	}
+}
+
+func TestEnvOverride(t *testing.T) {
+	setup(t)
+
+	for _, name := range []string{"staging", "dev"} {
+		if err := profile.Add(profile.Profile{Name: name, ComputeEndpoint: "https://compute." + name + ".example"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := profile.Switch("staging"); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("NSC_PROFILE", "dev")
+
+	if got := profile.Active(); got != "dev" {
+		t.Errorf("Active() = %q, want dev", got)
+	}
+
+	if got := apienv.ComputeEndpoint(); got != "https://compute.dev.example" {
+		t.Errorf("ComputeEndpoint() = %q", got)
+	}
+
+	// The environment wins over the profile's overrides.
+	t.Setenv("NSC_ENDPOINT", "https://compute.env.example")
+
+	if got := apienv.ComputeEndpoint(); got != "https://compute.env.example" {
+		t.Errorf("ComputeEndpoint() = %q", got)
+	}
+}
@@ -0,0 +1,200 @@
+// Package telemetry instruments the SDK's gRPC connections and HTTP calls with
+// OpenTelemetry. Spans and metrics are reported to the global tracer and meter
+// providers (see otel.SetTracerProvider), and are no-ops until those are set.
+//
+// In addition to the standard otelgrpc and otelhttp instrumentation, every
+// call records:
+//
+//   - nsc.client.duration, a histogram of call latency in seconds; and
+//   - nsc.client.errors, a count of failed calls;
+//
+// with the transport (grpc, http or websocket), operation and endpoint as
+// attributes. gRPC calls which fail with Unauthenticated, and are retried with
+// a new token, are counted by nsc.client.reauthentications, with their outcome
+// (see ReauthOutcomeKey) as an additional attribute. The tenant is only added to spans, to keep the cardinality of
+// metrics bounded.
+package telemetry
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/stats"
+	"namespacelabs.dev/integrations/auth/tokenclaims"
+)
+
+const instrumentationName = "namespacelabs.dev/integrations"
+
+var (
+	TransportKey = attribute.Key("nsc.transport")
+	OperationKey = attribute.Key("nsc.operation")
+	EndpointKey  = attribute.Key("nsc.endpoint")
+	TenantKey    = attribute.Key("nsc.tenant_id")
+
+	// One of ReauthRetried, ReauthRecovered or ReauthNotRetried.
+	ReauthOutcomeKey = attribute.Key("nsc.reauth.outcome")
+)
+
+const (
+	// A call was retried with a new token.
+	ReauthRetried = "retried"
+	// A retried call succeeded.
+	ReauthRecovered = "recovered"
+	// A call could not be retried, e.g. a stream which had already exchanged
+	// messages.
+	ReauthNotRetried = "not_retried"
+)
+
+type instruments struct {
+	duration metric.Float64Histogram
+	errors   metric.Int64Counter
+	reauths  metric.Int64Counter
+}
+
+var getInstruments = sync.OnceValue(func() instruments {
+	// Instruments obtained from the global provider are forwarded to the
+	// provider that is eventually set.
+	meter := otel.GetMeterProvider().Meter(instrumentationName)
+
+	duration, _ := meter.Float64Histogram("nsc.client.duration",
+		metric.WithDescription("Latency of calls to Namespace."),
+		metric.WithUnit("s"))
+
+	errors, _ := meter.Int64Counter("nsc.client.errors",
+		metric.WithDescription("Failed calls to Namespace."))
+
+	reauths, _ := meter.Int64Counter("nsc.client.reauthentications",
+		metric.WithDescription("Calls to Namespace which failed with Unauthenticated, by whether they were retried with a new token."))
+
+	return instruments{duration, errors, reauths}
+})
+
+// Record records the metrics of a call which started at start, and failed if
+// err is set.
+func Record(ctx context.Context, start time.Time, err error, attrs ...attribute.KeyValue) {
+	inst := getInstruments()
+	set := metric.WithAttributes(attrs...)
+
+	inst.duration.Record(ctx, time.Since(start).Seconds(), set)
+
+	if err != nil {
+		inst.errors.Add(ctx, 1, set)
+	}
+}
+
+// RecordReauthentication counts a call which failed with Unauthenticated, with
+// outcome (e.g. ReauthRetried) as its ReauthOutcomeKey.
+func RecordReauthentication(ctx context.Context, outcome string, attrs ...attribute.KeyValue) {
+	attrs = append(attrs[:len(attrs):len(attrs)], ReauthOutcomeKey.String(outcome))
+	getInstruments().reauths.Add(ctx, 1, metric.WithAttributes(attrs...))
+}
+
+// StartSpan starts a span for an operation which is not covered by the gRPC or
+// HTTP instrumentation, e.g. a websocket dial. Call the returned function with
+// the operation's outcome to end the span and record its metrics.
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, func(error)) {
+	start := time.Now()
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...))
+
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+
+		span.End()
+		Record(ctx, start, err, attrs...)
+	}
+}
+
+// GRPCStatsHandler returns the handler which traces the calls of a gRPC
+// connection to endpoint.
+func GRPCStatsHandler(endpoint string) stats.Handler {
+	return otelgrpc.NewClientHandler(
+		otelgrpc.WithSpanAttributes(EndpointKey.String(endpoint)),
+		otelgrpc.WithMetricAttributes(EndpointKey.String(endpoint)))
+}
+
+// Transport wraps base (or http.DefaultTransport, if nil) to trace requests
+// and record their metrics. The tenant is determined from the request's bearer
+// token, if any, and added to the request's span.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return otelhttp.NewTransport(recordingTransport{base},
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return "HTTP " + r.Method + " " + r.URL.Host
+		}))
+}
+
+// HTTPClient is an http.Client whose requests are instrumented.
+var HTTPClient = &http.Client{Transport: Transport(nil)}
+
+type recordingTransport struct {
+	base http.RoundTripper
+}
+
+func (t recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	attrs := []attribute.KeyValue{
+		TransportKey.String("http"),
+		OperationKey.String(req.Method),
+		EndpointKey.String(req.URL.Host),
+	}
+
+	if bearer, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer "); ok {
+		AnnotateTenant(req.Context(), bearer)
+	}
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+
+	failure := err
+	if err == nil && resp.StatusCode >= 400 {
+		failure = httpError(resp.Status)
+	}
+
+	Record(req.Context(), start, failure, attrs...)
+	return resp, err
+}
+
+type httpError string
+
+func (e httpError) Error() string { return string(e) }
+
+// TenantOf returns the tenant a Namespace token was issued for, or an empty
+// string if it can't be determined. The token is not verified.
+func TenantOf(token string) string {
+	claims, err := tokenclaims.Parse(token)
+	if err != nil {
+		return ""
+	}
+
+	return claims.TenantID
+}
+
+// AnnotateTenant adds the tenant token was issued for, if it can be
+// determined, to the span of ctx.
+func AnnotateTenant(ctx context.Context, token string) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+
+	if tenant := TenantOf(token); tenant != "" {
+		span.SetAttributes(TenantKey.String(tenant))
+	}
+}
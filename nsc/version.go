@@ -1,3 +1,5 @@
 package nsc
 
-const Version = "1"
+import "namespacelabs.dev/integrations/nsc/internal/version"
+
+const Version = version.Version